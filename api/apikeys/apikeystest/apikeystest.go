@@ -0,0 +1,26 @@
+// Package apikeystest opens API key stores for tests.
+package apikeystest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"revenue-dashboard-api/apikeys"
+)
+
+// DSN names a store in a directory removed when the test ends.
+func DSN(t testing.TB) string {
+	t.Helper()
+	return "file:" + filepath.Join(t.TempDir(), "keys.db")
+}
+
+// Open opens an empty store, closed when the test ends.
+func Open(t testing.TB) *apikeys.Store {
+	t.Helper()
+	store, err := apikeys.Open(DSN(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
@@ -0,0 +1,351 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Prefix starts every secret the store issues, so AuthMiddleware can tell
+// them apart from other credentials.
+const Prefix = "rdk_"
+
+// Key statuses.
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+	StatusRevoked = "revoked"
+)
+
+// lastUsedInterval limits how often using a key writes its last-used time.
+const lastUsedInterval = time.Minute
+
+var (
+	ErrUnknownKey = errors.New("unknown api key")
+	ErrRevoked    = errors.New("api key revoked")
+	ErrExpired    = errors.New("api key expired")
+)
+
+const schema = `create table if not exists api_keys (
+	id text primary key,
+	name text not null,
+	salt blob not null,
+	hash blob not null,
+	roles text not null,
+	accounts text not null,
+	created_at text not null,
+	expires_at text,
+	last_used_at text,
+	revoked_at text
+)`
+
+// Key is an API key as listed to admins. The secret is only returned when
+// the key is created or rotated; the store keeps a salted SHA-256 of it.
+// Roles and Accounts are its scope: what the principal it authenticates as
+// may read.
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Roles      []string   `json:"roles"`
+	Accounts   []string   `json:"accounts"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+
+	salt []byte
+	hash []byte
+}
+
+// Store keeps API keys in a SQLite database of their own, so they survive
+// restarts and can be managed while the server runs whatever the warehouse
+// driver.
+type Store struct {
+	db *sql.DB
+	// issued counts the keys ever created, revoked ones included, so
+	// AuthMiddleware can tell whether the store is in use without a query
+	// per request.
+	issued atomic.Int64
+}
+
+func Open(dsn string) (*Store, error) {
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: conn}
+	if _, err := conn.Exec(schema); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("api keys: %w", err)
+	}
+	if err := s.count(context.Background()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewStore opens the store at API_KEY_DSN, by default api_keys.db in the
+// working directory.
+func NewStore() *Store {
+	dsn := os.Getenv("API_KEY_DSN")
+	if dsn == "" {
+		dsn = "file:./api_keys.db?_pragma=busy_timeout=5000&_pragma=journal_mode=WAL"
+	}
+	store, err := Open(dsn)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// HasKeys reports whether any key was ever created. Revoking every key
+// does not change it: once keys are in use, credentials stay required.
+func (s *Store) HasKeys() bool {
+	return s.issued.Load() > 0
+}
+
+func (s *Store) count(ctx context.Context) error {
+	var n int64
+	if err := s.db.QueryRowContext(ctx, "select count(*) from api_keys").Scan(&n); err != nil {
+		return fmt.Errorf("api keys: %w", err)
+	}
+	s.issued.Store(n)
+	return nil
+}
+
+// Create issues a key and returns it with its secret.
+func (s *Store) Create(ctx context.Context, name string, roles, accounts []string, expiresAt *time.Time) (Key, string, error) {
+	id, err := randomHex(6)
+	if err != nil {
+		return Key{}, "", err
+	}
+	key := Key{ID: "key_" + id, Name: name, Roles: roles, Accounts: accounts, CreatedAt: now(), ExpiresAt: expiresAt}
+	secret, err := key.newSecret()
+	if err != nil {
+		return Key{}, "", err
+	}
+	rolesJSON, _ := json.Marshal(roles)
+	accountsJSON, _ := json.Marshal(accounts)
+	_, err = s.db.ExecContext(ctx,
+		"insert into api_keys (id, name, salt, hash, roles, accounts, created_at, expires_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		key.ID, name, key.salt, key.hash, string(rolesJSON), string(accountsJSON), formatTime(&key.CreatedAt), formatTime(expiresAt))
+	if err != nil {
+		return Key{}, "", fmt.Errorf("api keys: %w", err)
+	}
+	s.issued.Add(1)
+	key.Status = key.status(key.CreatedAt)
+	return key, secret, nil
+}
+
+// List returns every key, revoked and expired ones included, newest first.
+func (s *Store) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx, "select "+keyColumns+" from api_keys order by created_at desc, id")
+	if err != nil {
+		return nil, fmt.Errorf("api keys: %w", err)
+	}
+	defer rows.Close()
+	keys := []Key{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Store) Get(ctx context.Context, id string) (Key, error) {
+	key, err := scanKey(s.db.QueryRowContext(ctx, "select "+keyColumns+" from api_keys where id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	return key, err
+}
+
+// Rotate replaces a key's secret, keeping its id, name, scope and expiry.
+// The old secret stops working at once.
+func (s *Store) Rotate(ctx context.Context, id string) (Key, string, error) {
+	key, err := s.Get(ctx, id)
+	if err != nil {
+		return Key{}, "", err
+	}
+	if key.RevokedAt != nil {
+		return Key{}, "", fmt.Errorf("%w: %s", ErrRevoked, id)
+	}
+	secret, err := key.newSecret()
+	if err != nil {
+		return Key{}, "", err
+	}
+	if _, err := s.db.ExecContext(ctx, "update api_keys set salt = ?, hash = ? where id = ?", key.salt, key.hash, id); err != nil {
+		return Key{}, "", fmt.Errorf("api keys: %w", err)
+	}
+	return key, secret, nil
+}
+
+// Revoke disables a key for good. Revoking a revoked key is a no-op.
+func (s *Store) Revoke(ctx context.Context, id string) (Key, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return Key{}, err
+	}
+	if _, err := s.db.ExecContext(ctx, "update api_keys set revoked_at = ? where id = ? and revoked_at is null", formatTime(ptr(now())), id); err != nil {
+		return Key{}, fmt.Errorf("api keys: %w", err)
+	}
+	return s.Get(ctx, id)
+}
+
+// Authenticate returns the key a secret belongs to if it is active, and
+// records that it was used.
+func (s *Store) Authenticate(ctx context.Context, secret string) (Key, error) {
+	id, ok := secretID(secret)
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	key, err := s.Get(ctx, id)
+	if errors.Is(err, ErrUnknownKey) {
+		return Key{}, ErrUnknownKey
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	sum := sha256.Sum256(append(append([]byte{}, key.salt...), secret...))
+	if subtle.ConstantTimeCompare(sum[:], key.hash) != 1 {
+		return Key{}, ErrUnknownKey
+	}
+	switch key.Status {
+	case StatusRevoked:
+		return Key{}, ErrRevoked
+	case StatusExpired:
+		return Key{}, ErrExpired
+	}
+
+	used := now()
+	if key.LastUsedAt == nil || used.Sub(*key.LastUsedAt) >= lastUsedInterval {
+		if _, err := s.db.ExecContext(ctx, "update api_keys set last_used_at = ? where id = ?", formatTime(&used), id); err != nil {
+			return Key{}, fmt.Errorf("api keys: %w", err)
+		}
+		key.LastUsedAt = &used
+	}
+	return key, nil
+}
+
+// newSecret draws a secret for the key and sets its salt and hash. Secrets
+// are Prefix, the key id and 32 random bytes, so the id locates the row
+// without trusting the rest.
+func (k *Key) newSecret() (string, error) {
+	random := make([]byte, 32)
+	salt := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	secret := Prefix + k.ID + "." + base64.RawURLEncoding.EncodeToString(random)
+	sum := sha256.Sum256(append(append([]byte{}, salt...), secret...))
+	k.salt, k.hash = salt, sum[:]
+	return secret, nil
+}
+
+func secretID(secret string) (string, bool) {
+	if !strings.HasPrefix(secret, Prefix) {
+		return "", false
+	}
+	id, random, ok := strings.Cut(strings.TrimPrefix(secret, Prefix), ".")
+	return id, ok && id != "" && random != ""
+}
+
+const keyColumns = "id, name, salt, hash, roles, accounts, created_at, expires_at, last_used_at, revoked_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanKey(row scanner) (Key, error) {
+	var (
+		key                        Key
+		roles, accounts, created   string
+		expires, lastUsed, revoked sql.NullString
+	)
+	if err := row.Scan(&key.ID, &key.Name, &key.salt, &key.hash, &roles, &accounts, &created, &expires, &lastUsed, &revoked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Key{}, err
+		}
+		return Key{}, fmt.Errorf("api keys: %w", err)
+	}
+	if err := json.Unmarshal([]byte(roles), &key.Roles); err != nil {
+		return Key{}, fmt.Errorf("api keys: %s roles: %w", key.ID, err)
+	}
+	if err := json.Unmarshal([]byte(accounts), &key.Accounts); err != nil {
+		return Key{}, fmt.Errorf("api keys: %s accounts: %w", key.ID, err)
+	}
+	key.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+	key.ExpiresAt = parseTime(expires)
+	key.LastUsedAt = parseTime(lastUsed)
+	key.RevokedAt = parseTime(revoked)
+	key.Status = key.status(now())
+	return key, nil
+}
+
+func (k Key) status(at time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return StatusRevoked
+	case k.ExpiresAt != nil && !at.Before(*k.ExpiresAt):
+		return StatusExpired
+	}
+	return StatusActive
+}
+
+func randomHex(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
+
+func formatTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,152 @@
+package apikeys_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"revenue-dashboard-api/apikeys"
+	"revenue-dashboard-api/apikeys/apikeystest"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	store := apikeystest.Open(t)
+	past := time.Now().Add(-time.Hour)
+
+	active, activeSecret, err := store.Create(ctx, "active", []string{"viewer"}, []string{"acct_001"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, expiredSecret, err := store.Create(ctx, "expired", []string{"viewer"}, []string{"acct_001"}, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedSecret, err := store.Create(ctx, "revoked", []string{"viewer"}, []string{"acct_001"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Revoke(ctx, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	rotated, oldSecret, err := store.Create(ctx, "rotated", []string{"admin"}, []string{"*"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, newSecret, err := store.Rotate(ctx, rotated.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		id     string
+		err    error
+	}{
+		{name: "active", secret: activeSecret, id: active.ID},
+		{name: "rotated", secret: newSecret, id: rotated.ID},
+		{name: "secret before rotation", secret: oldSecret, err: apikeys.ErrUnknownKey},
+		{name: "expired", secret: expiredSecret, err: apikeys.ErrExpired},
+		{name: "revoked", secret: revokedSecret, err: apikeys.ErrRevoked},
+		{name: "wrong secret for a known id", secret: apikeys.Prefix + active.ID + ".not-the-secret", err: apikeys.ErrUnknownKey},
+		{name: "unknown id", secret: apikeys.Prefix + "key_000000.abc", err: apikeys.ErrUnknownKey},
+		{name: "no prefix", secret: "tenantkey", err: apikeys.ErrUnknownKey},
+		{name: "no random part", secret: apikeys.Prefix + active.ID, err: apikeys.ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := store.Authenticate(ctx, tt.secret)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.ID != tt.id {
+				t.Errorf("id = %q, want %q", key.ID, tt.id)
+			}
+			if key.LastUsedAt == nil {
+				t.Error("last used time not recorded")
+			}
+		})
+	}
+}
+
+func TestKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := apikeystest.Open(t)
+	if store.HasKeys() {
+		t.Fatal("empty store has keys")
+	}
+
+	key, _, err := store.Create(ctx, "ci", []string{"viewer", "analyst"}, []string{"acct_001", "acct_003"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.HasKeys() {
+		t.Fatal("HasKeys false after Create")
+	}
+	got, err := store.Get(ctx, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "ci" || len(got.Roles) != 2 || len(got.Accounts) != 2 || got.Status != apikeys.StatusActive {
+		t.Errorf("Get = %+v", got)
+	}
+
+	revoked, err := store.Revoke(ctx, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.Status != apikeys.StatusRevoked || revoked.RevokedAt == nil {
+		t.Errorf("Revoke = %+v", revoked)
+	}
+	if !store.HasKeys() {
+		t.Error("HasKeys false after every key was revoked")
+	}
+	if _, _, err := store.Rotate(ctx, key.ID); !errors.Is(err, apikeys.ErrRevoked) {
+		t.Errorf("Rotate of a revoked key: err = %v, want %v", err, apikeys.ErrRevoked)
+	}
+	if _, err := store.Revoke(ctx, "key_missing"); !errors.Is(err, apikeys.ErrUnknownKey) {
+		t.Errorf("Revoke of an unknown key: err = %v, want %v", err, apikeys.ErrUnknownKey)
+	}
+
+	list, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != key.ID {
+		t.Errorf("List = %+v", list)
+	}
+}
+
+func TestHasKeysSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	dsn := apikeystest.DSN(t)
+	store, err := apikeys.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _, err := store.Create(ctx, "ci", []string{"viewer"}, []string{"*"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Revoke(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+
+	reopened, err := apikeys.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if !reopened.HasKeys() {
+		t.Error("HasKeys false after reopening a store whose keys are all revoked")
+	}
+}
@@ -0,0 +1,20 @@
+// Package audittest opens audit logs for tests.
+package audittest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"revenue-dashboard-api/audit"
+)
+
+// Open opens an empty log, closed and removed when the test ends.
+func Open(t testing.TB) *audit.Log {
+	t.Helper()
+	log, err := audit.Open("file:" + filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = log.Close() })
+	return log
+}
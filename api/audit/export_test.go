@@ -0,0 +1,9 @@
+package audit
+
+import "context"
+
+// Exec runs a statement against the log's table, bypassing Record.
+func (l *Log) Exec(ctx context.Context, statement string) error {
+	_, err := l.db.ExecContext(ctx, statement)
+	return err
+}
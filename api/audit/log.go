@@ -0,0 +1,277 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// timeLayout is fixed width, so stored times sort as text.
+const timeLayout = "2006-01-02T15:04:05.000000Z"
+
+// The triggers make the tables append-only: rows can be inserted but never
+// changed or removed through the database. audit_log.account holds an
+// entry's accounts comma-joined for reading it back; audit_log_accounts
+// holds them one per row for filtering on.
+const schema = `create table if not exists audit_log (
+	id integer primary key autoincrement,
+	ts text not null,
+	principal text not null,
+	roles text not null,
+	method text not null,
+	route text not null,
+	path text not null,
+	account text not null,
+	params text not null,
+	status integer not null,
+	latency_ms real not null,
+	ip text not null
+);
+create index if not exists audit_log_principal on audit_log (principal, id);
+create index if not exists audit_log_ts on audit_log (ts);
+create table if not exists audit_log_accounts (
+	entry_id integer not null references audit_log (id),
+	account text not null,
+	primary key (account, entry_id)
+);
+create index if not exists audit_log_accounts_entry on audit_log_accounts (entry_id);
+create trigger if not exists audit_log_no_update before update on audit_log
+begin
+	select raise(abort, 'audit log is append-only');
+end;
+create trigger if not exists audit_log_no_delete before delete on audit_log
+begin
+	select raise(abort, 'audit log is append-only');
+end;
+create trigger if not exists audit_log_accounts_no_update before update on audit_log_accounts
+begin
+	select raise(abort, 'audit log is append-only');
+end;
+create trigger if not exists audit_log_accounts_no_delete before delete on audit_log_accounts
+begin
+	select raise(abort, 'audit log is append-only');
+end`
+
+// Entry is one audited request. Principal is empty when the caller was not
+// authenticated, and Accounts when the request was not scoped to an account;
+// a listing scoped to several accounts names each.
+// Route is the route pattern the request matched, empty when it matched
+// none or was refused before reaching it.
+type Entry struct {
+	ID        int64             `json:"id"`
+	Time      time.Time         `json:"time"`
+	Principal string            `json:"principal"`
+	Roles     []string          `json:"roles"`
+	Method    string            `json:"method"`
+	Route     string            `json:"route"`
+	Path      string            `json:"path"`
+	Accounts  []string          `json:"accounts"`
+	Params    map[string]string `json:"params"`
+	Status    int               `json:"status"`
+	LatencyMS float64           `json:"latency_ms"`
+	IP        string            `json:"ip"`
+}
+
+// Filter selects entries. Zero fields match everything; Account matches
+// entries naming it among their accounts. From is inclusive and To
+// exclusive. Before pages backwards: only entries with a smaller id
+// match.
+type Filter struct {
+	Principal string
+	Account   string
+	From      time.Time
+	To        time.Time
+	Before    int64
+	Limit     int
+}
+
+// Log keeps audit entries in a SQLite database of their own, apart from the
+// warehouse, so they are kept whatever the warehouse driver.
+type Log struct {
+	db *sql.DB
+}
+
+func Open(dsn string) (*Log, error) {
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(schema); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	log := &Log{db: conn}
+	if err := log.indexAccounts(context.Background()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return log, nil
+}
+
+// indexAccounts fills audit_log_accounts for entries recorded before it
+// existed.
+func (l *Log) indexAccounts(ctx context.Context) error {
+	rows, err := l.db.QueryContext(ctx, "select id, account from audit_log where account <> ''"+
+		" and not exists (select 1 from audit_log_accounts a where a.entry_id = audit_log.id)")
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	unindexed := map[int64][]string{}
+	for rows.Next() {
+		var (
+			id      int64
+			account string
+		)
+		if err := rows.Scan(&id, &account); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("audit: %w", err)
+		}
+		unindexed[id] = splitAccounts(account)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	for id, accounts := range unindexed {
+		for _, account := range accounts {
+			if _, err := l.db.ExecContext(ctx, "insert into audit_log_accounts (entry_id, account) values (?, ?)", id, account); err != nil {
+				return fmt.Errorf("audit: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// NewLog opens the log at AUDIT_DSN, by default audit.db in the working
+// directory.
+func NewLog() *Log {
+	dsn := os.Getenv("AUDIT_DSN")
+	if dsn == "" {
+		dsn = "file:./audit.db?_pragma=busy_timeout=5000&_pragma=journal_mode=WAL"
+	}
+	log, err := Open(dsn)
+	if err != nil {
+		panic(err)
+	}
+	return log
+}
+
+func (l *Log) Close() error {
+	return l.db.Close()
+}
+
+// Record appends an entry, with one row per account for Query to match.
+func (l *Log) Record(ctx context.Context, entry Entry) error {
+	roles, _ := json.Marshal(nonNil(entry.Roles))
+	params, _ := json.Marshal(entry.Params)
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	result, err := tx.ExecContext(ctx,
+		"insert into audit_log (ts, principal, roles, method, route, path, account, params, status, latency_ms, ip) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.Time.UTC().Format(timeLayout), entry.Principal, string(roles), entry.Method, entry.Route, entry.Path,
+		strings.Join(entry.Accounts, ","), string(params), entry.Status, entry.LatencyMS, entry.IP)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	for _, account := range entry.Accounts {
+		if _, err := tx.ExecContext(ctx, "insert or ignore into audit_log_accounts (entry_id, account) values (?, ?)", id, account); err != nil {
+			return fmt.Errorf("audit: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+// Query returns the entries matching filter, newest first.
+func (l *Log) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filter.Principal != "" {
+		where = append(where, "principal = ?")
+		args = append(args, filter.Principal)
+	}
+	if filter.Account != "" {
+		where = append(where, "exists (select 1 from audit_log_accounts a where a.entry_id = audit_log.id and a.account = ?)")
+		args = append(args, filter.Account)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "ts >= ?")
+		args = append(args, filter.From.UTC().Format(timeLayout))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "ts < ?")
+		args = append(args, filter.To.UTC().Format(timeLayout))
+	}
+	if filter.Before > 0 {
+		where = append(where, "id < ?")
+		args = append(args, filter.Before)
+	}
+	query := "select id, ts, principal, roles, method, route, path, account, params, status, latency_ms, ip from audit_log"
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by id desc"
+	if filter.Limit > 0 {
+		query += " limit " + strconv.Itoa(filter.Limit)
+	}
+
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		var (
+			entry         Entry
+			ts, account   string
+			roles, params string
+		)
+		if err := rows.Scan(&entry.ID, &ts, &entry.Principal, &roles, &entry.Method, &entry.Route, &entry.Path,
+			&account, &params, &entry.Status, &entry.LatencyMS, &entry.IP); err != nil {
+			return nil, fmt.Errorf("audit: %w", err)
+		}
+		entry.Time, _ = time.Parse(timeLayout, ts)
+		entry.Accounts = splitAccounts(account)
+		if err := json.Unmarshal([]byte(roles), &entry.Roles); err != nil {
+			return nil, fmt.Errorf("audit: entry %d roles: %w", entry.ID, err)
+		}
+		if err := json.Unmarshal([]byte(params), &entry.Params); err != nil {
+			return nil, fmt.Errorf("audit: entry %d params: %w", entry.ID, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func splitAccounts(account string) []string {
+	if account == "" {
+		return []string{}
+	}
+	return strings.Split(account, ",")
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,173 @@
+package audit_test
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"revenue-dashboard-api/audit"
+	"revenue-dashboard-api/audit/audittest"
+)
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	log := audittest.Open(t)
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	entries := []audit.Entry{
+		{Time: base, Principal: "ops", Roles: []string{"admin"}, Accounts: []string{"*"}},
+		{Time: base.Add(time.Hour), Principal: "reader", Accounts: []string{"acct_001"}, Params: map[string]string{"start_date": "2026-09-01"}},
+		{Time: base.Add(2 * time.Hour), Principal: "reader", Accounts: []string{"acct_003"}},
+		{Time: base.Add(3 * time.Hour)},
+		{Time: base.Add(24 * time.Hour), Principal: "ops", Accounts: []string{"acct_001"}},
+		{Time: base.Add(25 * time.Hour), Principal: "reader", Accounts: []string{"acct_001", "acct_003"}},
+	}
+	for _, entry := range entries {
+		entry.Method, entry.Path, entry.Status = "GET", "/api/metrics/revenue", 200
+		if err := log.Record(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   string
+	}{
+		{name: "everything, newest first", want: "6,5,4,3,2,1"},
+		{name: "principal", filter: audit.Filter{Principal: "reader"}, want: "6,3,2"},
+		{name: "account", filter: audit.Filter{Account: "acct_001"}, want: "6,5,2"},
+		{name: "account of a multi-account listing", filter: audit.Filter{Account: "acct_003"}, want: "6,3"},
+		{name: "every account", filter: audit.Filter{Account: "*"}, want: "1"},
+		{name: "principal and account", filter: audit.Filter{Principal: "ops", Account: "acct_001"}, want: "5"},
+		{name: "from is inclusive", filter: audit.Filter{From: base.Add(time.Hour)}, want: "6,5,4,3,2"},
+		{name: "to is exclusive", filter: audit.Filter{To: base.Add(2 * time.Hour)}, want: "2,1"},
+		{name: "day", filter: audit.Filter{From: base, To: base.Add(24 * time.Hour)}, want: "4,3,2,1"},
+		{name: "before", filter: audit.Filter{Before: 3}, want: "2,1"},
+		{name: "limit", filter: audit.Filter{Limit: 2}, want: "6,5"},
+		{name: "page", filter: audit.Filter{Before: 4, Limit: 2}, want: "3,2"},
+		{name: "no match", filter: audit.Filter{Principal: "nobody"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := log.Query(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]string, len(got))
+			for i, entry := range got {
+				ids[i] = strconv.FormatInt(entry.ID, 10)
+			}
+			if strings.Join(ids, ",") != tt.want {
+				t.Errorf("ids = %s, want %s", strings.Join(ids, ","), tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	log := audittest.Open(t)
+	at := time.Date(2026, 10, 1, 12, 0, 0, 123456000, time.UTC)
+	entry := audit.Entry{
+		Time:      at,
+		Principal: "reader",
+		Roles:     []string{"viewer", "analyst"},
+		Method:    "GET",
+		Route:     "/api/accounts/:account_id",
+		Path:      "/api/accounts/acct_001",
+		Accounts:  []string{"acct_001", "acct_003"},
+		Params:    map[string]string{"granularity": "month"},
+		Status:    403,
+		LatencyMS: 1.5,
+		IP:        "10.0.0.1",
+	}
+	if err := log.Record(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Record(ctx, audit.Entry{Time: at, Method: "GET", Path: "/api/nowhere", Status: 404}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := log.Query(ctx, audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("%d entries, want 2", len(got))
+	}
+	recorded := got[1]
+	if !recorded.Time.Equal(at) || recorded.Principal != "reader" || strings.Join(recorded.Roles, ",") != "viewer,analyst" ||
+		recorded.Route != entry.Route || strings.Join(recorded.Accounts, ",") != "acct_001,acct_003" || recorded.Params["granularity"] != "month" || recorded.Status != 403 ||
+		recorded.LatencyMS != 1.5 || recorded.IP != "10.0.0.1" {
+		t.Errorf("recorded %+v, want %+v", recorded, entry)
+	}
+	if anonymous := got[0]; anonymous.Roles == nil || len(anonymous.Roles) != 0 || anonymous.Accounts == nil || len(anonymous.Accounts) != 0 || anonymous.Params != nil {
+		t.Errorf("anonymous entry %+v: want empty roles and accounts and no params", anonymous)
+	}
+}
+
+func TestAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	log := audittest.Open(t)
+	if err := log.Record(ctx, audit.Entry{Time: time.Now(), Principal: "ops", Accounts: []string{"*"}, Method: "GET", Path: "/api/admin/keys", Status: 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		statement string
+	}{
+		{name: "update", statement: "update audit_log set principal = 'someone-else'"},
+		{name: "delete", statement: "delete from audit_log"},
+		{name: "update accounts", statement: "update audit_log_accounts set account = 'acct_002'"},
+		{name: "delete accounts", statement: "delete from audit_log_accounts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := log.Exec(ctx, tt.statement)
+			if err == nil || !strings.Contains(err.Error(), "append-only") {
+				t.Fatalf("err = %v, want the append-only trigger to abort", err)
+			}
+		})
+	}
+
+	got, err := log.Query(ctx, audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Principal != "ops" {
+		t.Errorf("entries after refused changes = %+v", got)
+	}
+}
+
+func TestIndexesAccountsOfEarlierEntries(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:" + filepath.Join(t.TempDir(), "audit.db")
+	log, err := audit.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Entries recorded before audit_log_accounts existed only carry the
+	// joined accounts.
+	if err := log.Exec(ctx, `insert into audit_log (ts, principal, roles, method, route, path, account, params, status, latency_ms, ip)
+		values ('2026-10-01T12:00:00.000000Z', 'reader', '[]', 'GET', '/api/accounts', '/api/accounts', 'acct_001,acct_003', 'null', 200, 1, '')`); err != nil {
+		t.Fatal(err)
+	}
+	_ = log.Close()
+
+	log, err = audit.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	got, err := log.Query(ctx, audit.Filter{Account: "acct_003"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || strings.Join(got[0].Accounts, ",") != "acct_001,acct_003" {
+		t.Errorf("entries for acct_003 = %+v", got)
+	}
+}
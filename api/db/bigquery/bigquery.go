@@ -0,0 +1,116 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"revenue-dashboard-api/db"
+)
+
+type Warehouse struct {
+	bq      *bigquery.Client
+	project string
+	dataset string
+}
+
+func init() {
+	db.Register("bigquery", Open)
+}
+
+func Open() (db.Warehouse, error) {
+	project := os.Getenv("WAREHOUSE_PROJECT")
+	if project == "" {
+		return nil, errors.New("WAREHOUSE_PROJECT is required for bigquery")
+	}
+	dataset := os.Getenv("WAREHOUSE_DATASET")
+	if dataset == "" {
+		return nil, errors.New("WAREHOUSE_DATASET is required for bigquery")
+	}
+
+	ctx := context.Background()
+	creds := os.Getenv("WAREHOUSE_CREDENTIALS")
+	var bqClient *bigquery.Client
+	var err error
+	if creds != "" {
+		bqClient, err = bigquery.NewClient(ctx, project, option.WithCredentialsFile(creds))
+	} else {
+		bqClient, err = bigquery.NewClient(ctx, project)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Warehouse{bq: bqClient, project: project, dataset: dataset}, nil
+}
+
+func (w *Warehouse) Close() error {
+	if w.bq == nil {
+		return nil
+	}
+	return w.bq.Close()
+}
+
+func (w *Warehouse) Dialect() db.Dialect {
+	return Dialect{Project: w.project, Dataset: w.dataset}
+}
+
+// Query runs a generated query. Positional arguments are passed as the named
+// parameters @p1, @p2, ... emitted by Dialect.Placeholder.
+func (w *Warehouse) Query(ctx context.Context, sqlText string, args ...interface{}) ([]db.Row, error) {
+	query := w.bq.Query(sqlText)
+	for i, arg := range args {
+		query.Parameters = append(query.Parameters, bigquery.QueryParameter{Name: fmt.Sprintf("p%d", i+1), Value: arg})
+	}
+	job, err := query.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+	db.AddBytes(ctx, billedBytes(status.Statistics))
+	iter, err := job.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []db.Row{}
+	for {
+		var values []bigquery.Value
+		err := iter.Next(&values)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := make(db.Row, len(values))
+		for i, field := range iter.Schema {
+			row[field.Name] = values[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// billedBytes is what a finished query job was billed for, falling back to
+// the bytes it processed when the job has no query statistics.
+func billedBytes(stats *bigquery.JobStatistics) int64 {
+	if stats == nil {
+		return 0
+	}
+	if query, ok := stats.Details.(*bigquery.QueryStatistics); ok {
+		return query.TotalBytesBilled
+	}
+	return stats.TotalBytesProcessed
+}
@@ -0,0 +1,52 @@
+package bigquery
+
+import (
+	"fmt"
+
+	"revenue-dashboard-api/db"
+)
+
+type Dialect struct {
+	Project string
+	Dataset string
+}
+
+func (Dialect) Name() string {
+	return "bigquery"
+}
+
+func (Dialect) Placeholder(n int) string {
+	return fmt.Sprintf("@p%d", n)
+}
+
+func (d Dialect) Table(name string) string {
+	return fmt.Sprintf("`%s.%s.%s`", d.Project, d.Dataset, name)
+}
+
+func (Dialect) Date(expr string) string {
+	return "cast(" + expr + " as date)"
+}
+
+func (Dialect) DateTrunc(expr, granularity string) string {
+	if granularity == db.GranularityDay {
+		return "cast(" + expr + " as date)"
+	}
+	if granularity == db.GranularityWeek {
+		granularity = "isoweek"
+	}
+	return "date_trunc(cast(" + expr + " as date), " + granularity + ")"
+}
+
+func (Dialect) DaysBetween(from, to string) string {
+	return "date_diff(cast(" + to + " as date), cast(" + from + " as date), day)"
+}
+
+func (Dialect) DecimalText(expr string) string {
+	return "cast(" + expr + " as string)"
+}
+
+// Decimal reads text as BIGNUMERIC, which holds any NUMERIC exactly; against
+// a FLOAT64 it is coerced to the same double the text came from.
+func (Dialect) Decimal(expr string) string {
+	return "cast(" + expr + " as bignumeric)"
+}
@@ -0,0 +1,85 @@
+package db
+
+import "strings"
+
+// Dialect describes the SQL differences between warehouse backends that the
+// query generators need to know about.
+type Dialect interface {
+	Name() string
+	// Placeholder returns the bind marker for the n-th (1-based) argument.
+	Placeholder(n int) string
+	// Table returns the fully qualified reference for a mart table.
+	Table(name string) string
+	// Date casts an expression (usually a placeholder) to a DATE.
+	Date(expr string) string
+	// DateTrunc returns the DATE starting the granularity bucket that contains
+	// expr. Weeks are ISO weeks starting on Monday.
+	DateTrunc(expr, granularity string) string
+	// DaysBetween returns the whole days from one date expression to another
+	// as an integer.
+	DaysBetween(from, to string) string
+	// DecimalText formats a numeric expression as text that Decimal reads
+	// back to exactly the same value, so it can be carried in a cursor.
+	DecimalText(expr string) string
+	// Decimal casts an expression (usually a placeholder bound to text from
+	// DecimalText) to a number that compares exactly with amounts.
+	Decimal(expr string) string
+}
+
+// Trend granularities accepted by Dialect.DateTrunc.
+const (
+	GranularityDay     = "day"
+	GranularityWeek    = "week"
+	GranularityMonth   = "month"
+	GranularityQuarter = "quarter"
+	GranularityYear    = "year"
+)
+
+// Builder accumulates bind arguments while a query is assembled so generators
+// never interpolate user input into SQL text.
+type Builder struct {
+	dialect Dialect
+	args    []interface{}
+}
+
+func NewBuilder(dialect Dialect) *Builder {
+	return &Builder{dialect: dialect}
+}
+
+func (b *Builder) Dialect() Dialect {
+	return b.dialect
+}
+
+// Arg binds value and returns its placeholder.
+func (b *Builder) Arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return b.dialect.Placeholder(len(b.args))
+}
+
+// DateArg binds a YYYY-MM-DD string and returns it cast to a DATE.
+func (b *Builder) DateArg(value string) string {
+	return b.dialect.Date(b.Arg(value))
+}
+
+func (b *Builder) Args() []interface{} {
+	return b.args
+}
+
+// Rebind rewrites "?" markers in a hand-written query to the dialect's
+// placeholders.
+func Rebind(dialect Dialect, query string) string {
+	if dialect.Placeholder(1) == "?" {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString(dialect.Placeholder(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
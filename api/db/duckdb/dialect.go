@@ -0,0 +1,44 @@
+//go:build duckdb
+
+package duckdb
+
+import "revenue-dashboard-api/db"
+
+type Dialect struct{}
+
+func (Dialect) Name() string {
+	return "duckdb"
+}
+
+func (Dialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (Dialect) Table(name string) string {
+	return name
+}
+
+func (Dialect) Date(expr string) string {
+	return "cast(" + expr + " as date)"
+}
+
+func (Dialect) DateTrunc(expr, granularity string) string {
+	if granularity == db.GranularityDay {
+		return "cast(" + expr + " as date)"
+	}
+	return "cast(date_trunc('" + granularity + "', " + expr + ") as date)"
+}
+
+func (Dialect) DaysBetween(from, to string) string {
+	return "date_diff('day', cast(" + from + " as date), cast(" + to + " as date))"
+}
+
+func (Dialect) DecimalText(expr string) string {
+	return "cast(" + expr + " as varchar)"
+}
+
+// Decimal reads text as the widest DECIMAL, which holds the products of
+// exported amounts and rates exactly.
+func (Dialect) Decimal(expr string) string {
+	return "cast(" + expr + " as decimal(38, 18))"
+}
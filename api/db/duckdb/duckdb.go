@@ -0,0 +1,93 @@
+//go:build duckdb
+
+package duckdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	_ "github.com/marcboeker/go-duckdb"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/db/sqldb"
+)
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func init() {
+	db.Register("duckdb", Open)
+}
+
+// Open serves the warehouse from a directory of exported dbt marts. Every
+// <table>.parquet, <table>.csv or <table>/ directory of Parquet files becomes a
+// view named <table>, so the shared SQL store can query them unchanged.
+func Open() (db.Warehouse, error) {
+	dir := os.Getenv("WAREHOUSE_DATA_DIR")
+	if dir == "" {
+		return nil, errors.New("WAREHOUSE_DATA_DIR is required for duckdb")
+	}
+
+	dbConn, err := sql.Open("duckdb", os.Getenv("WAREHOUSE_DSN"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createViews(context.Background(), dbConn, dir); err != nil {
+		_ = dbConn.Close()
+		return nil, err
+	}
+
+	return sqldb.New(dbConn, Dialect{}), nil
+}
+
+func createViews(ctx context.Context, conn *sql.DB, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	created := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+
+		var table, source string
+		switch {
+		case entry.IsDir():
+			table = name
+			source = fmt.Sprintf("read_parquet(%s, hive_partitioning = true)", quote(filepath.Join(path, "**", "*.parquet")))
+		case strings.HasSuffix(name, ".parquet"):
+			table = strings.TrimSuffix(name, ".parquet")
+			source = fmt.Sprintf("read_parquet(%s)", quote(path))
+		case strings.HasSuffix(name, ".csv"):
+			table = strings.TrimSuffix(name, ".csv")
+			source = fmt.Sprintf("read_csv_auto(%s, header = true)", quote(path))
+		default:
+			continue
+		}
+		if !tableName.MatchString(table) {
+			continue
+		}
+
+		query := fmt.Sprintf("create or replace view %s as select * from %s", table, source)
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("duckdb: create view %s: %w", table, err)
+		}
+		created++
+	}
+
+	if created == 0 {
+		return fmt.Errorf("duckdb: no parquet or csv files found in %s", dir)
+	}
+	return nil
+}
+
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
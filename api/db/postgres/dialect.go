@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"strconv"
+
+	"revenue-dashboard-api/db"
+)
+
+type Dialect struct{}
+
+func (Dialect) Name() string {
+	return "postgres"
+}
+
+func (Dialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (Dialect) Table(name string) string {
+	return name
+}
+
+func (Dialect) Date(expr string) string {
+	return "cast(" + expr + " as date)"
+}
+
+func (Dialect) DateTrunc(expr, granularity string) string {
+	if granularity == db.GranularityDay {
+		return "cast(" + expr + " as date)"
+	}
+	return "cast(date_trunc('" + granularity + "', " + expr + ") as date)"
+}
+
+func (Dialect) DaysBetween(from, to string) string {
+	return "(cast(" + to + " as date) - cast(" + from + " as date))"
+}
+
+func (Dialect) DecimalText(expr string) string {
+	return "cast(" + expr + " as text)"
+}
+
+func (Dialect) Decimal(expr string) string {
+	return "cast(" + expr + " as numeric)"
+}
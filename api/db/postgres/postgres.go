@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/db/sqldb"
+)
+
+func init() {
+	db.Register("postgres", Open)
+}
+
+func Open() (db.Warehouse, error) {
+	dsn := os.Getenv("WAREHOUSE_DSN")
+	if dsn == "" {
+		return nil, errors.New("WAREHOUSE_DSN is required for postgres")
+	}
+
+	dbConn, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := dbConn.PingContext(ctx); err != nil {
+		_ = dbConn.Close()
+		return nil, err
+	}
+
+	store := sqldb.New(dbConn, Dialect{})
+	if os.Getenv("WAREHOUSE_MIGRATE") != "false" {
+		if err := store.Migrate(ctx); err != nil {
+			_ = store.Close()
+			return nil, err
+		}
+		if err := store.Seed(ctx); err != nil {
+			_ = store.Close()
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// Row is one result row keyed by column name. Values keep the driver's native
+// types; use the accessors to read them uniformly across backends.
+type Row map[string]interface{}
+
+func (r Row) Float(column string) float64 {
+	value, _ := ToFloat(r[column])
+	return value
+}
+
+func (r Row) Int(column string) int {
+	return int(r.Float(column))
+}
+
+func (r Row) String(column string) string {
+	switch v := r[column].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Date formats a date column as YYYY-MM-DD whether the driver returned text,
+// time.Time or a civil date.
+func (r Row) Date(column string) string {
+	return FormatDate(r[column])
+}
+
+// Time reads a timestamp column, parsing the text forms SQLite returns.
+func (r Row) Time(column string) (time.Time, bool) {
+	switch v := r[column].(type) {
+	case time.Time:
+		return v, true
+	case []byte:
+		return parseTime(string(v))
+	case string:
+		return parseTime(v)
+	default:
+		return time.Time{}, false
+	}
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02"}
+
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func FormatDate(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format("2006-01-02")
+	case []byte:
+		return FormatDate(string(v))
+	case string:
+		if len(v) > 10 {
+			return v[:10]
+		}
+		return v
+	default:
+		return FormatDate(fmt.Sprint(v))
+	}
+}
+
+// ToFloat converts the numeric types returned by the supported drivers
+// (DuckDB DECIMAL and HUGEINT, Postgres NUMERIC as text, BigQuery NUMERIC as
+// *big.Rat) to float64.
+func ToFloat(src interface{}) (float64, error) {
+	switch v := src.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case []byte:
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f, nil
+	case interface{ Float64() float64 }:
+		return v.Float64(), nil
+	default:
+		return 0, fmt.Errorf("db: cannot convert %T to a number", src)
+	}
+}
@@ -0,0 +1,481 @@
+package sqldb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *Store) Migrate(ctx context.Context) error {
+	queries := []string{
+		`create table if not exists fact_orders (
+			order_id text primary key,
+			order_date date not null,
+			account_id text not null,
+			user_id text,
+			product_id text,
+			gross_amount numeric,
+			discount_amount numeric,
+			refund_amount numeric,
+			tax_amount numeric,
+			net_amount numeric not null,
+			currency text
+		);`,
+		`create table if not exists fact_sessions (
+			session_id text primary key,
+			session_date date not null,
+			account_id text not null,
+			user_id text,
+			channel_id integer,
+			had_conversion integer not null
+		);`,
+		`create table if not exists fact_session_events (
+			session_id text not null,
+			step text not null,
+			event_ts timestamp not null
+		);`,
+		`create table if not exists fact_active_users (
+			user_id text not null,
+			activity_date date not null,
+			account_id text not null,
+			primary key (user_id, activity_date)
+		);`,
+		`create table if not exists fact_subscriptions (
+			subscription_id text primary key,
+			account_id text not null,
+			mrr numeric not null,
+			is_active integer not null
+		);`,
+		`create table if not exists fact_subscription_mrr (
+			subscription_id text not null,
+			account_id text not null,
+			effective_date date not null,
+			mrr numeric not null,
+			primary key (subscription_id, effective_date)
+		);`,
+		`create table if not exists fact_mrr_snapshots (
+			snapshot_date date not null,
+			account_id text not null,
+			mrr numeric not null,
+			primary key (snapshot_date, account_id)
+		);`,
+		`create table if not exists fact_customer_snapshots (
+			snapshot_date date not null,
+			account_id text not null,
+			active_customers integer not null,
+			primary key (snapshot_date, account_id)
+		);`,
+		`create table if not exists fact_marketing_spend (
+			spend_date date not null,
+			account_id text not null,
+			channel_id integer,
+			amount numeric not null,
+			primary key (spend_date, account_id, channel_id)
+		);`,
+		`create table if not exists dim_account (
+			account_id text primary key,
+			account_name text not null,
+			industry text,
+			plan_type text,
+			sales_region text,
+			account_status text
+		);`,
+		`create table if not exists dim_user (
+			user_id text primary key,
+			account_id text not null,
+			country_code text,
+			user_type text,
+			signup_ts timestamp
+		);`,
+		`create table if not exists dim_product (
+			product_id text primary key,
+			sku text not null,
+			product_name text not null,
+			product_category text,
+			product_type text,
+			currency text,
+			base_price numeric
+		);`,
+		`create table if not exists dim_exchange_rates (
+			rate_date date not null,
+			from_currency text not null,
+			to_currency text not null,
+			rate numeric not null,
+			primary key (rate_date, from_currency, to_currency)
+		);`,
+		`create table if not exists dim_channel (
+			channel_id integer primary key,
+			channel_name text not null,
+			source text,
+			medium text,
+			campaign text,
+			channel_group text
+		);`,
+	}
+
+	for _, q := range queries {
+		if _, err := s.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range addedColumns {
+		if err := s.addColumn(ctx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addedColumns brings databases created by earlier versions of the schema up
+// to date; the create table statements above already include them.
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"fact_orders", "user_id", "text"},
+	{"fact_orders", "product_id", "text"},
+	{"fact_orders", "currency", "text"},
+	{"fact_orders", "gross_amount", "numeric"},
+	{"fact_orders", "discount_amount", "numeric"},
+	{"fact_orders", "refund_amount", "numeric"},
+	{"fact_orders", "tax_amount", "numeric"},
+	{"fact_sessions", "user_id", "text"},
+	{"fact_sessions", "channel_id", "integer"},
+	{"fact_marketing_spend", "channel_id", "integer"},
+}
+
+func (s *Store) addColumn(ctx context.Context, table, column, definition string) error {
+	if _, err := s.ExecContext(ctx, "select "+column+" from "+table+" where 1 = 0"); err == nil {
+		return nil
+	}
+	_, err := s.ExecContext(ctx, "alter table "+table+" add column "+column+" "+definition)
+	return err
+}
+
+// Seed fills empty tables with dev data. Each group of tables is seeded on its
+// own so tables added by later schema versions get data in existing databases.
+func (s *Store) Seed(ctx context.Context) error {
+	seeds := []struct {
+		table string
+		seed  func(context.Context) error
+	}{
+		{"fact_orders", s.seedFacts},
+		{"dim_account", s.seedDimensions},
+		{"fact_subscription_mrr", s.seedSubscriptionMRR},
+		{"fact_session_events", s.seedSessionEvents},
+		{"dim_channel", s.seedChannels},
+		{"dim_exchange_rates", s.seedExchangeRates},
+	}
+
+	for _, seed := range seeds {
+		empty, err := s.empty(ctx, seed.table)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			continue
+		}
+		if err := seed.seed(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) empty(ctx context.Context, table string) (bool, error) {
+	var count int
+	if err := s.QueryRowContext(ctx, "select count(*) from "+table).Scan(&count); err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+func (s *Store) seedFacts(ctx context.Context) error {
+	insertOrder := `insert into fact_orders (order_id, order_date, account_id, user_id, product_id, gross_amount, discount_amount, refund_amount, tax_amount, net_amount, currency) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	insertSession := `insert into fact_sessions (session_id, session_date, account_id, user_id, channel_id, had_conversion) values (?, ?, ?, ?, ?, ?);`
+	insertActiveUser := `insert into fact_active_users (user_id, activity_date, account_id) values (?, ?, ?);`
+	insertSubscription := `insert into fact_subscriptions (subscription_id, account_id, mrr, is_active) values (?, ?, ?, ?);`
+	insertMRRSnapshot := `insert into fact_mrr_snapshots (snapshot_date, account_id, mrr) values (?, ?, ?);`
+	insertCustomerSnapshot := `insert into fact_customer_snapshots (snapshot_date, account_id, active_customers) values (?, ?, ?);`
+	insertMarketingSpend := `insert into fact_marketing_spend (spend_date, account_id, channel_id, amount) values (?, ?, ?, ?);`
+
+	now := time.Now().UTC()
+	for i := 0; i < 30; i++ {
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+		accountID := "acct_001"
+		orderID := fmt.Sprintf("order_%02d", i+1)
+		userID := seedUserID(i)
+		productID := seedProducts[i%len(seedProducts)].id
+		amount := float64(1000 + i*25)
+		// Every third order is discounted and every tenth partly refunded;
+		// gross adds discounts, refunds and tax back onto net.
+		var discount, refund float64
+		if i%3 == 0 {
+			discount = 50
+		}
+		if i%10 == 4 {
+			refund = 100
+		}
+		tax := amount * 0.08
+		gross := amount + discount + refund + tax
+
+		if _, err := s.ExecContext(ctx, insertOrder, orderID, date, accountID, userID, productID, gross, discount, refund, tax, amount, "USD"); err != nil {
+			return err
+		}
+
+		for n := 0; n < 40; n++ {
+			sessionID := fmt.Sprintf("sess_%02d_%02d", i+1, n+1)
+			hadConversion := 0
+			if n%10 == 0 {
+				hadConversion = 1
+			}
+			channelID := seedChannels[(n+i)%len(seedChannels)].id
+			if _, err := s.ExecContext(ctx, insertSession, sessionID, date, accountID, seedUserID(n), channelID, hadConversion); err != nil {
+				return err
+			}
+		}
+
+		for u := 0; u < 20; u++ {
+			if _, err := s.ExecContext(ctx, insertActiveUser, seedUserID(u), date, accountID); err != nil {
+				return err
+			}
+		}
+
+		// Paid search takes most of the daily budget and email a flat 100.
+		spend := float64(300 + i*5)
+		if _, err := s.ExecContext(ctx, insertMarketingSpend, date, accountID, seedChannelPaidSearch, spend-100); err != nil {
+			return err
+		}
+		if _, err := s.ExecContext(ctx, insertMarketingSpend, date, accountID, seedChannelEmail, 100); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		subscriptionID := fmt.Sprintf("sub_%02d", i+1)
+		accountID := "acct_001"
+		mrr := float64(500 + i*100)
+		if _, err := s.ExecContext(ctx, insertSubscription, subscriptionID, accountID, mrr, 1); err != nil {
+			return err
+		}
+	}
+
+	// Daily snapshots move MRR from 2500 to 2800 and customers from 120 to
+	// 110 over the 30 days.
+	for i := 0; i <= 30; i++ {
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+		if _, err := s.ExecContext(ctx, insertMRRSnapshot, date, "acct_001", 2800-i*10); err != nil {
+			return err
+		}
+		if _, err := s.ExecContext(ctx, insertCustomerSnapshot, date, "acct_001", 110+i/3); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seedSubscriptionMRR records each subscription's MRR changes, one of every
+// movement in the last 30 days: sub_01 expands, sub_02 contracts, sub_03
+// churns, sub_04 is new and sub_05 comes back after churning.
+func (s *Store) seedSubscriptionMRR(ctx context.Context) error {
+	insertChange := `insert into fact_subscription_mrr (subscription_id, account_id, effective_date, mrr) values (?, ?, ?, ?);`
+
+	now := time.Now().UTC()
+	changes := []struct {
+		subscriptionID string
+		daysAgo        int
+		mrr            float64
+	}{
+		{"sub_01", 90, 500},
+		{"sub_01", 10, 700},
+		{"sub_02", 90, 600},
+		{"sub_02", 12, 450},
+		{"sub_03", 90, 700},
+		{"sub_03", 5, 0},
+		{"sub_04", 20, 800},
+		{"sub_05", 120, 900},
+		{"sub_05", 60, 0},
+		{"sub_05", 8, 900},
+	}
+	for _, c := range changes {
+		date := now.AddDate(0, 0, -c.daysAgo).Format("2006-01-02")
+		if _, err := s.ExecContext(ctx, insertChange, c.subscriptionID, "acct_001", date, c.mrr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedSessionEvents walks the seeded sessions through the checkout funnel:
+// every session visits, and fewer go on to each later step. Converted
+// sessions (every tenth) reach the purchase.
+func (s *Store) seedSessionEvents(ctx context.Context) error {
+	insertEvent := `insert into fact_session_events (session_id, step, event_ts) values (?, ?, ?);`
+	steps := []struct {
+		name   string
+		offset time.Duration
+	}{
+		{"visit", 0},
+		{"product_view", 2 * time.Minute},
+		{"add_to_cart", 5 * time.Minute},
+		{"purchase", 9 * time.Minute},
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for i := 0; i < 30; i++ {
+		day := today.AddDate(0, 0, -i).Add(9 * time.Hour)
+		for n := 0; n < 40; n++ {
+			reached := 1
+			switch {
+			case n%10 == 0:
+				reached = 4
+			case n%10 <= 2:
+				reached = 3
+			case n%10 <= 5:
+				reached = 2
+			}
+			sessionID := fmt.Sprintf("sess_%02d_%02d", i+1, n+1)
+			start := day.Add(time.Duration(n) * 7 * time.Minute)
+			for _, step := range steps[:reached] {
+				// Later sessions take a little longer over each step.
+				ts := start.Add(step.offset * time.Duration(10+n%5) / 10).Format("2006-01-02 15:04:05")
+				if _, err := s.ExecContext(ctx, insertEvent, sessionID, step.name, ts); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// seedChannels mirrors data/seeds/dim_channel.csv from the dbt project.
+func (s *Store) seedChannels(ctx context.Context) error {
+	insertChannel := `insert into dim_channel (channel_id, channel_name, source, medium, campaign, channel_group) values (?, ?, ?, ?, ?, ?);`
+	for _, c := range seedChannels {
+		var campaign interface{}
+		if c.campaign != "" {
+			campaign = c.campaign
+		}
+		if _, err := s.ExecContext(ctx, insertChannel, c.id, c.name, c.source, c.medium, campaign, c.group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedExchangeRates writes a daily rate into USD for each seeded currency,
+// drifting slightly from day to day.
+func (s *Store) seedExchangeRates(ctx context.Context) error {
+	insertRate := `insert into dim_exchange_rates (rate_date, from_currency, to_currency, rate) values (?, ?, ?, ?);`
+	rates := []struct {
+		currency string
+		rate     float64
+	}{
+		{"EUR", 1.08},
+		{"GBP", 1.27},
+		{"CAD", 0.73},
+	}
+
+	now := time.Now().UTC()
+	for i := 0; i < 400; i++ {
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+		for _, r := range rates {
+			rate := r.rate * (1 + float64(i%7)/1000)
+			if _, err := s.ExecContext(ctx, insertRate, date, r.currency, "USD", rate); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const seedUsers = 20
+
+var seedCountries = []string{"US", "CA", "GB", "DE"}
+
+// seedAccounts lists the accounts; only the first has facts.
+var seedAccounts = []struct {
+	id       string
+	name     string
+	industry string
+	plan     string
+	region   string
+	status   string
+}{
+	{"acct_001", "Acme Corp", "software", "enterprise", "north_america", "active"},
+	{"acct_002", "Globex", "retail", "growth", "emea", "active"},
+	{"acct_003", "Initech", "finance", "starter", "apac", "churned"},
+}
+
+var seedProducts = []struct {
+	id       string
+	sku      string
+	name     string
+	category string
+	kind     string
+	price    float64
+}{
+	{"prod_001", "RCI-CORE", "Core Analytics", "platform", "subscription", 1000},
+	{"prod_002", "RCI-SEATS", "Additional Seats", "add_on", "subscription", 50},
+	{"prod_003", "RCI-ONBOARD", "Onboarding Package", "services", "one_time", 1500},
+}
+
+const (
+	seedChannelPaidSearch = 2
+	seedChannelEmail      = 4
+)
+
+var seedChannels = []struct {
+	id       int
+	name     string
+	source   string
+	medium   string
+	campaign string
+	group    string
+}{
+	{1, "Organic Search", "google", "organic", "", "Organic"},
+	{seedChannelPaidSearch, "Paid Search", "google", "cpc", "brand_search", "Paid Search"},
+	{3, "Direct", "direct", "direct", "", "Direct"},
+	{seedChannelEmail, "Email", "mailchimp", "email", "weekly_newsletter", "Email"},
+}
+
+func seedUserID(i int) string {
+	return fmt.Sprintf("user_%02d", i%seedUsers+1)
+}
+
+func (s *Store) seedDimensions(ctx context.Context) error {
+	insertAccount := `insert into dim_account (account_id, account_name, industry, plan_type, sales_region, account_status) values (?, ?, ?, ?, ?, ?);`
+	insertUser := `insert into dim_user (user_id, account_id, country_code, user_type, signup_ts) values (?, ?, ?, ?, ?);`
+	insertProduct := `insert into dim_product (product_id, sku, product_name, product_category, product_type, currency, base_price) values (?, ?, ?, ?, ?, ?, ?);`
+
+	for _, a := range seedAccounts {
+		if _, err := s.ExecContext(ctx, insertAccount, a.id, a.name, a.industry, a.plan, a.region, a.status); err != nil {
+			return err
+		}
+	}
+
+	signup := time.Now().UTC().AddDate(0, -6, 0)
+	for u := 0; u < seedUsers; u++ {
+		userType := "member"
+		if u == 0 {
+			userType = "admin"
+		}
+		signupTS := signup.AddDate(0, 0, u*7).Format("2006-01-02 15:04:05")
+		if _, err := s.ExecContext(ctx, insertUser, seedUserID(u), "acct_001", seedCountries[u%len(seedCountries)], userType, signupTS); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range seedProducts {
+		if _, err := s.ExecContext(ctx, insertProduct, p.id, p.sku, p.name, p.category, p.kind, "USD", p.price); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+
+	"revenue-dashboard-api/db"
+)
+
+// Store implements db.Warehouse on top of any database/sql driver.
+type Store struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+var _ db.Warehouse = (*Store)(nil)
+
+func New(conn *sql.DB, dialect db.Dialect) *Store {
+	return &Store{db: conn, dialect: dialect}
+}
+
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Store) Dialect() db.Dialect {
+	return s.dialect
+}
+
+func (s *Store) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *Store) Query(ctx context.Context, query string, args ...interface{}) ([]db.Row, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []db.Row{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(db.Row, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// ExecContext and QueryRowContext accept hand-written queries with "?"
+// placeholders and rebind them for the dialect.
+func (s *Store) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.db.ExecContext(ctx, db.Rebind(s.dialect, query), args...)
+}
+
+func (s *Store) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRowContext(ctx, db.Rebind(s.dialect, query), args...)
+}
@@ -0,0 +1,57 @@
+package sqlite
+
+import "revenue-dashboard-api/db"
+
+type Dialect struct{}
+
+func (Dialect) Name() string {
+	return "sqlite"
+}
+
+func (Dialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (Dialect) Table(name string) string {
+	return name
+}
+
+// Date leaves expressions untouched: SQLite stores dates as YYYY-MM-DD text,
+// which compares correctly as a string.
+func (Dialect) Date(expr string) string {
+	return expr
+}
+
+// DateTrunc uses date() modifiers. "weekday 0" moves forward to the next
+// Sunday (or stays on one), so stepping back six days lands on the ISO
+// Monday; quarters step back from the start of the month by its offset in
+// the quarter.
+func (Dialect) DateTrunc(expr, granularity string) string {
+	switch granularity {
+	case db.GranularityWeek:
+		return "date(" + expr + ", 'weekday 0', '-6 days')"
+	case db.GranularityMonth:
+		return "date(" + expr + ", 'start of month')"
+	case db.GranularityQuarter:
+		return "date(" + expr + ", 'start of month', '-' || ((cast(strftime('%m', " + expr + ") as integer) - 1) % 3) || ' months')"
+	case db.GranularityYear:
+		return "date(" + expr + ", 'start of year')"
+	default:
+		return "date(" + expr + ")"
+	}
+}
+
+func (Dialect) DaysBetween(from, to string) string {
+	return "cast(julianday(" + to + ") - julianday(" + from + ") as integer)"
+}
+
+// DecimalText prints 17 significant digits, enough for any REAL to read
+// back unchanged. cast(... as text) stops at 15 and printf at 16 without
+// the ! flag.
+func (Dialect) DecimalText(expr string) string {
+	return "printf('%!.17g', " + expr + ")"
+}
+
+func (Dialect) Decimal(expr string) string {
+	return "cast(" + expr + " as real)"
+}
@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"os"
+
+	_ "modernc.org/sqlite"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/db/sqldb"
+)
+
+func init() {
+	db.Register("sqlite", Open)
+}
+
+func Open() (db.Warehouse, error) {
+	dsn := os.Getenv("WAREHOUSE_DSN")
+	if dsn == "" {
+		dsn = "file:./dev.db?cache=shared&_pragma=busy_timeout=5000&_pragma=journal_mode=WAL"
+	}
+	store, err := OpenDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// OpenDSN opens the database at dsn, creating and seeding the dev schema.
+func OpenDSN(dsn string) (*sqldb.Store, error) {
+	dbConn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	store := sqldb.New(dbConn, Dialect{})
+	if err := store.Migrate(context.Background()); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	if err := store.Seed(context.Background()); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
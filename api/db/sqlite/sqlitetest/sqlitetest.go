@@ -0,0 +1,22 @@
+// Package sqlitetest opens seeded SQLite warehouses for tests.
+package sqlitetest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"revenue-dashboard-api/db/sqldb"
+	"revenue-dashboard-api/db/sqlite"
+)
+
+// Open opens a warehouse holding the dev seed data, dated relative to
+// today, in a directory removed when the test ends.
+func Open(t testing.TB) *sqldb.Store {
+	t.Helper()
+	warehouse, err := sqlite.OpenDSN("file:" + filepath.Join(t.TempDir(), "warehouse.db") + "?_pragma=busy_timeout=5000&_pragma=synchronous=off&_pragma=journal_mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = warehouse.Close() })
+	return warehouse
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type usageKey struct{}
+
+// Usage accumulates the bytes the warehouse billed for the queries of one
+// request. Drivers that bill by bytes scanned report them with AddBytes;
+// the others leave it at zero.
+type Usage struct {
+	bytes atomic.Int64
+}
+
+// WithUsage makes queries run under the returned context add to usage.
+func WithUsage(ctx context.Context, usage *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, usage)
+}
+
+// AddBytes records bytes billed for a query run under ctx, if ctx tracks
+// usage.
+func AddBytes(ctx context.Context, n int64) {
+	if usage, ok := UsageFrom(ctx); ok {
+		usage.bytes.Add(n)
+	}
+}
+
+func (u *Usage) Bytes() int64 {
+	return u.bytes.Load()
+}
+
+// UsageFrom returns the usage ctx tracks, if any.
+func UsageFrom(ctx context.Context) (*Usage, bool) {
+	usage, ok := ctx.Value(usageKey{}).(*Usage)
+	return usage, ok
+}
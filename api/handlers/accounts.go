@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/middleware"
+	"revenue-dashboard-api/reports"
+)
+
+const (
+	accountsTTL         = 10 * time.Minute
+	defaultAccountsPage = 25
+	maxAccountsPage     = 100
+)
+
+// GetAccounts serves the account leaderboard at /api/accounts: revenue, MRR,
+// MRR change, last order date and active users per account for the window,
+// sorted by ?sort (default revenue) in ?order=asc|desc (default desc) and
+// paged by ?page and ?page_size (default 25). ?filter applies to dim_account
+// attributes. Callers with several accounts see those accounts; MRR and
+// active users are left out for callers whose roles don't grant their family.
+func GetAccounts(cache *redis.Client, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "accounts"
+		principal, ok := middleware.CurrentPrincipal(c)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
+				Error:  "unauthorized",
+				Metric: metric,
+			})
+		}
+		if c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "group_by is not supported on accounts")
+		}
+		sortBy := c.Query("sort", "revenue")
+		order := c.Query("order", reports.SortDescending)
+		page, err := strconv.Atoi(c.Query("page", "1"))
+		if err != nil || page < 1 {
+			return invalidParameter(c, metric, "page must be a positive integer")
+		}
+		pageSize, err := strconv.Atoi(c.Query("page_size", strconv.Itoa(defaultAccountsPage)))
+		if err != nil || pageSize < 1 || pageSize > maxAccountsPage {
+			return invalidParameter(c, metric, "page_size must be between 1 and "+strconv.Itoa(maxAccountsPage))
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+		if params.Currency != db.DefaultCurrency {
+			return invalidParameter(c, metric, "accounts are only reported in "+db.DefaultCurrency)
+		}
+
+		scope := middleware.AccountScope(c)
+		cacheKey := metricCacheKey(c, metric, params, false) + ":" + sortBy + ":" + order + ":" + strconv.Itoa(page) + ":" + strconv.Itoa(pageSize) +
+			":" + strings.Join(principal.Families(), ",")
+		if len(scope) > 0 {
+			cacheKey += ":of:" + strings.Join(scope, ",")
+		}
+		return serveMetric(c, cache, metric, cacheKey, accountsTTL, func(ctx context.Context) (MetricResponse, error) {
+			accounts, err := reports.GetAccounts(ctx, warehouse, sortBy, order, page, pageSize, scope, principal.Can, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      accounts,
+				Unit:       db.UnitCurrency,
+				Currency:   db.DefaultCurrency,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
+
+// GetAccount serves one account at /api/accounts/:account_id: its
+// leaderboard row and every registry metric scoped to it that the caller's
+// roles grant.
+func GetAccount(cache *redis.Client, registry *metrics.Registry, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "account"
+		id := c.Params("account_id")
+		principal, ok := middleware.CurrentPrincipal(c)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
+				Error:  "unauthorized",
+				Metric: metric,
+			})
+		}
+		if c.Query("filter") != "" || c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "filter and group_by are not supported on account detail")
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+		if params.Currency != db.DefaultCurrency {
+			return invalidParameter(c, metric, "accounts are only reported in "+db.DefaultCurrency)
+		}
+
+		cacheKey := metric + ":" + id + ":" + params.StartDate + ":" + params.EndDate + ":" + strings.Join(principal.Families(), ",")
+		return serveMetric(c, cache, metric, cacheKey, accountsTTL, func(ctx context.Context) (MetricResponse, error) {
+			detail, err := reports.GetAccountDetail(ctx, registry, warehouse, id, principal.Can, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      detail,
+				Currency:   db.DefaultCurrency,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
+
+func unknownAccount(c *fiber.Ctx, metric string) error {
+	return c.Status(http.StatusNotFound).JSON(ErrorResponse{
+		Error:  "unknown_account",
+		Metric: metric,
+	})
+}
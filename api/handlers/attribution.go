@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/reports"
+)
+
+const (
+	attributionTTL      = 30 * time.Minute
+	defaultLookbackDays = 30
+	maxLookbackDays     = 365
+)
+
+// GetAttribution serves spend, attributed revenue, CAC and ROAS per channel
+// and channel group at /api/attribution, crediting orders with
+// ?model=first_touch|last_touch|linear|time_decay (default last_touch) over
+// sessions up to ?lookback_days (default 30) before each order.
+func GetAttribution(cache *redis.Client, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "attribution"
+		if c.Query("filter") != "" || c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "filter and group_by are not supported on attribution")
+		}
+		model := c.Query("model", reports.ModelLastTouch)
+		lookbackDays, err := strconv.Atoi(c.Query("lookback_days", strconv.Itoa(defaultLookbackDays)))
+		if err != nil || lookbackDays < 0 || lookbackDays > maxLookbackDays {
+			return invalidParameter(c, metric, "lookback_days must be between 0 and "+strconv.Itoa(maxLookbackDays))
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+		if params.Currency != db.DefaultCurrency {
+			return invalidParameter(c, metric, "attribution is only reported in "+db.DefaultCurrency)
+		}
+
+		cacheKey := metric + ":" + model + ":" + strconv.Itoa(lookbackDays) + ":" + params.StartDate + ":" + params.EndDate + ":" + params.AccountID
+		return serveMetric(c, cache, metric, cacheKey, attributionTTL, func(ctx context.Context) (MetricResponse, error) {
+			attribution, err := reports.GetAttribution(ctx, warehouse, model, lookbackDays, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      attribution,
+				Unit:       db.UnitCurrency,
+				Currency:   db.DefaultCurrency,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
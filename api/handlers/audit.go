@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/audit"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GetAuditLog serves GET /api/admin/audit: the audit log, newest first,
+// narrowed by ?principal, ?account and the ?from/?to time range (RFC 3339
+// times, or dates covering whole UTC days). ?limit (default 100) entries
+// come at a time; pass the next_cursor of a page as ?cursor to get the next
+// one.
+func GetAuditLog(log *audit.Log) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := audit.Filter{
+			Principal: c.Query("principal"),
+			Account:   c.Query("account"),
+		}
+		limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultAuditLimit)))
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			return invalidAuditQuery(c, "limit must be between 1 and "+strconv.Itoa(maxAuditLimit))
+		}
+		filter.Limit = limit
+		if cursor := c.Query("cursor"); cursor != "" {
+			before, err := strconv.ParseInt(cursor, 10, 64)
+			if err != nil || before < 1 {
+				return invalidAuditQuery(c, "cursor must be the next_cursor of a previous page")
+			}
+			filter.Before = before
+		}
+		if filter.From, err = parseAuditTime(c.Query("from"), false); err != nil {
+			return invalidAuditQuery(c, "from must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		if filter.To, err = parseAuditTime(c.Query("to"), true); err != nil {
+			return invalidAuditQuery(c, "to must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+			return invalidAuditQuery(c, "from must be before to")
+		}
+
+		entries, err := log.Query(c.Context(), filter)
+		if err != nil {
+			return err
+		}
+		var next *string
+		if len(entries) == limit {
+			cursor := strconv.FormatInt(entries[len(entries)-1].ID, 10)
+			next = &cursor
+		}
+		return c.JSON(fiber.Map{"entries": entries, "next_cursor": next})
+	}
+}
+
+// parseAuditTime reads an RFC 3339 time or a date. A date as the end of a
+// range covers that whole day, so it stands for the start of the next.
+func parseAuditTime(raw string, end bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+func invalidAuditQuery(c *fiber.Ctx, message string) error {
+	return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
+		Error:   "invalid_parameter",
+		Message: message,
+	})
+}
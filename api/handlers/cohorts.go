@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/reports"
+)
+
+const (
+	cohortTTL        = 30 * time.Minute
+	defaultPeriods   = 12
+	maxCohortPeriods = 52
+)
+
+// GetCohortRetention serves the retention matrix of users grouped by signup
+// ?period=week|month (default month). Cohorts are the signups between
+// start_date and end_date, or the last ?periods (default 12) periods when no
+// range is given.
+func GetCohortRetention(cache *redis.Client, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "cohort_retention"
+		if c.Query("filter") != "" || c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "filter and group_by are not supported on cohort retention")
+		}
+		period := c.Query("period", db.GranularityMonth)
+		periods, err := strconv.Atoi(c.Query("periods", strconv.Itoa(defaultPeriods)))
+		if err != nil || periods < 1 || periods > maxCohortPeriods {
+			return invalidParameter(c, metric, "periods must be between 1 and "+strconv.Itoa(maxCohortPeriods))
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+		if c.Query("start_date") == "" || c.Query("end_date") == "" {
+			now := time.Now().UTC()
+			params.EndDate = now.Format("2006-01-02")
+			if period == db.GranularityWeek {
+				params.StartDate = now.AddDate(0, 0, -7*periods).Format("2006-01-02")
+			} else {
+				params.StartDate = now.AddDate(0, -periods, 0).Format("2006-01-02")
+			}
+		}
+
+		cacheKey := metric + ":" + period + ":" + strconv.Itoa(periods) + ":" + params.StartDate + ":" + params.EndDate + ":" + params.AccountID
+		return serveMetric(c, cache, metric, cacheKey, cohortTTL, func(ctx context.Context) (MetricResponse, error) {
+			retention, err := reports.GetCohortRetention(ctx, warehouse, period, periods, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      retention,
+				Unit:       db.UnitPercent,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+const funnelTTL = 10 * time.Minute
+
+// GetFunnel serves a funnel defined in the semantic layer at
+// /api/funnels/:name for the sessions in the requested window.
+func GetFunnel(cache *redis.Client, registry *metrics.Registry, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		funnel, ok := registry.Funnel(c.Params("name"))
+		if !ok {
+			return c.Status(http.StatusNotFound).JSON(ErrorResponse{
+				Error:  "unknown_funnel",
+				Metric: c.Params("name"),
+			})
+		}
+		metric := "funnel_" + funnel.Name
+		if c.Query("filter") != "" || c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "filter and group_by are not supported on funnels")
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+
+		cacheKey := metric + ":" + params.StartDate + ":" + params.EndDate + ":" + params.AccountID
+		return serveMetric(c, cache, metric, cacheKey, funnelTTL, func(ctx context.Context) (MetricResponse, error) {
+			result, err := reports.GetFunnel(ctx, warehouse, funnel, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      result,
+				Unit:       db.UnitCount,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
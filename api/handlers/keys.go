@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/apikeys"
+	"revenue-dashboard-api/middleware"
+)
+
+// APIKeyResponse returns a key with its secret, which is shown only once.
+type APIKeyResponse struct {
+	Key    apikeys.Key `json:"key"`
+	Secret string      `json:"secret"`
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Roles     []string   `json:"roles"`
+	Accounts  []string   `json:"accounts"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	ExpiresIn string     `json:"expires_in"`
+}
+
+// ListAPIKeys serves GET /api/admin/keys: every key with its scope, expiry,
+// last use and status, but never its secret.
+func ListAPIKeys(keys *apikeys.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		list, err := keys.List(c.Context())
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"keys": list})
+	}
+}
+
+// CreateAPIKey serves POST /api/admin/keys. The JSON body names the key and
+// its scope: roles from the policy and accounts ("*" for all). The scope
+// cannot exceed the caller's own: every family the roles grant and every
+// account must be the caller's, and "*" needs a caller with every account.
+// expires_at (RFC 3339) or expires_in (a duration such as 720h) sets an
+// expiry.
+func CreateAPIKey(keys *apikeys.Store, policy *middleware.Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := middleware.CurrentPrincipal(c)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
+				Error: "unauthorized",
+			})
+		}
+		var req createAPIKeyRequest
+		if err := c.BodyParser(&req); err != nil {
+			return invalidKeyRequest(c, "body must be a JSON object")
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			return invalidKeyRequest(c, "name is required")
+		}
+		if len(req.Roles) == 0 {
+			return invalidKeyRequest(c, "roles is required")
+		}
+		for _, role := range req.Roles {
+			if !policy.HasRole(role) {
+				return invalidKeyRequest(c, "unknown role "+role)
+			}
+		}
+		if len(req.Accounts) == 0 {
+			return invalidKeyRequest(c, "accounts is required; use [\"*\"] for every account")
+		}
+		for _, account := range req.Accounts {
+			if strings.TrimSpace(account) == "" {
+				return invalidKeyRequest(c, "accounts must not be empty strings")
+			}
+		}
+		if message := keyScopeExceeds(policy, principal, req.Roles, req.Accounts); message != "" {
+			return forbiddenKeyScope(c, message)
+		}
+		expiresAt := req.ExpiresAt
+		if req.ExpiresIn != "" {
+			if expiresAt != nil {
+				return invalidKeyRequest(c, "set expires_at or expires_in, not both")
+			}
+			ttl, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || ttl <= 0 {
+				return invalidKeyRequest(c, "expires_in must be a positive duration such as 720h")
+			}
+			at := time.Now().UTC().Add(ttl).Truncate(time.Second)
+			expiresAt = &at
+		}
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			return invalidKeyRequest(c, "expires_at must be in the future")
+		}
+
+		key, secret, err := keys.Create(c.Context(), req.Name, req.Roles, req.Accounts, expiresAt)
+		if err != nil {
+			return err
+		}
+		return c.Status(http.StatusCreated).JSON(APIKeyResponse{Key: key, Secret: secret})
+	}
+}
+
+// RotateAPIKey serves POST /api/admin/keys/:id/rotate: the key gets a new
+// secret and the old one stops working. As with CreateAPIKey, the key's scope
+// cannot exceed the caller's own.
+func RotateAPIKey(keys *apikeys.Store, policy *middleware.Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ok, err := manageableKey(c, keys, policy); !ok {
+			return err
+		}
+		key, secret, err := keys.Rotate(c.Context(), c.Params("id"))
+		if err != nil {
+			return apiKeyError(c, err)
+		}
+		return c.JSON(APIKeyResponse{Key: key, Secret: secret})
+	}
+}
+
+// RevokeAPIKey serves DELETE /api/admin/keys/:id. Revoked keys stay listed.
+// As with CreateAPIKey, the key's scope cannot exceed the caller's own.
+func RevokeAPIKey(keys *apikeys.Store, policy *middleware.Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ok, err := manageableKey(c, keys, policy); !ok {
+			return err
+		}
+		key, err := keys.Revoke(c.Context(), c.Params("id"))
+		if err != nil {
+			return apiKeyError(c, err)
+		}
+		return c.JSON(fiber.Map{"key": key})
+	}
+}
+
+// manageableKey loads the key named by :id and reports whether the caller's
+// own scope covers it, responding with the refusal when it doesn't.
+func manageableKey(c *fiber.Ctx, keys *apikeys.Store, policy *middleware.Policy) (bool, error) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return false, c.Status(http.StatusUnauthorized).JSON(ErrorResponse{
+			Error: "unauthorized",
+		})
+	}
+	key, err := keys.Get(c.Context(), c.Params("id"))
+	if err != nil {
+		return false, apiKeyError(c, err)
+	}
+	if message := keyScopeExceeds(policy, principal, key.Roles, key.Accounts); message != "" {
+		return false, forbiddenKeyScope(c, message)
+	}
+	return true, nil
+}
+
+// keyScopeExceeds describes how roles and accounts exceed the principal's
+// own scope, or returns "" when they don't.
+func keyScopeExceeds(policy *middleware.Policy, principal *middleware.Principal, roles, accounts []string) string {
+	for _, role := range roles {
+		if !policy.Delegable(principal, role) {
+			return "role " + role + " grants families beyond the caller's roles"
+		}
+	}
+	for _, account := range accounts {
+		if !principal.HasAccount(account) {
+			return "the caller has no access to account " + account
+		}
+	}
+	return ""
+}
+
+func invalidKeyRequest(c *fiber.Ctx, message string) error {
+	return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
+		Error:   "invalid_parameter",
+		Message: message,
+	})
+}
+
+func forbiddenKeyScope(c *fiber.Ctx, message string) error {
+	return c.Status(http.StatusForbidden).JSON(ErrorResponse{
+		Error:   "forbidden",
+		Message: message,
+	})
+}
+
+func apiKeyError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, apikeys.ErrUnknownKey):
+		return c.Status(http.StatusNotFound).JSON(ErrorResponse{
+			Error:   "unknown_api_key",
+			Message: err.Error(),
+		})
+	case errors.Is(err, apikeys.ErrRevoked):
+		return c.Status(http.StatusConflict).JSON(ErrorResponse{
+			Error:   "api_key_revoked",
+			Message: err.Error(),
+		})
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/apikeys/apikeystest"
+	"revenue-dashboard-api/middleware"
+)
+
+// The legacy tenant key holds the default roles, admin here, on acct_002
+// only.
+const keysPolicy = `
+roles:
+  viewer:
+    families: [general, revenue]
+  finance:
+    families: [general, revenue, marketing]
+  admin:
+    families: ["*"]
+default_roles: [admin]
+principals:
+  - id: ops
+    roles: [admin]
+    accounts: ["*"]
+    api_keys: [k_ops]
+  - id: reader
+    roles: [viewer]
+    accounts: [acct_001, acct_003]
+    api_keys: [k_reader]
+`
+
+func TestCreateAPIKeyScope(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "tenantkey:acct_002")
+	policy, err := middleware.ParsePolicy([]byte(keysPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := apikeystest.Open(t)
+
+	app := fiber.New()
+	app.Use(middleware.AuthMiddleware(policy, nil, keys))
+	app.Post("/keys", CreateAPIKey(keys, policy))
+
+	tests := []struct {
+		name   string
+		caller string
+		body   string
+		status int
+	}{
+		{name: "single-account key asks for every account", caller: "tenantkey", body: `{"name":"x","roles":["admin"],"accounts":["*"]}`, status: 403},
+		{name: "single-account key asks for another account", caller: "tenantkey", body: `{"name":"x","roles":["viewer"],"accounts":["acct_001"]}`, status: 403},
+		{name: "single-account key within its scope", caller: "tenantkey", body: `{"name":"x","roles":["admin"],"accounts":["acct_002"]}`, status: 201},
+		{name: "viewer asks for admin", caller: "k_reader", body: `{"name":"x","roles":["admin"],"accounts":["acct_001"]}`, status: 403},
+		{name: "viewer asks for a wider role", caller: "k_reader", body: `{"name":"x","roles":["finance"],"accounts":["acct_001"]}`, status: 403},
+		{name: "viewer asks for every account", caller: "k_reader", body: `{"name":"x","roles":["viewer"],"accounts":["*"]}`, status: 403},
+		{name: "viewer within its scope", caller: "k_reader", body: `{"name":"x","roles":["viewer"],"accounts":["acct_001","acct_003"]}`, status: 201},
+		{name: "admin on every account", caller: "k_ops", body: `{"name":"x","roles":["admin"],"accounts":["*"]}`, status: 201},
+		{name: "unknown role", caller: "k_ops", body: `{"name":"x","roles":["owner"],"accounts":["*"]}`, status: 400},
+		{name: "no accounts", caller: "k_ops", body: `{"name":"x","roles":["viewer"]}`, status: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := send(t, app, "POST", "/keys", tt.caller, tt.body)
+			if status != tt.status {
+				t.Errorf("status = %d, want %d (%s)", status, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestManageAPIKeyScope(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "")
+	policy, err := middleware.ParsePolicy([]byte(keysPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := apikeystest.Open(t)
+
+	app := fiber.New()
+	app.Use(middleware.AuthMiddleware(policy, nil, keys))
+	app.Post("/keys/:id/rotate", RotateAPIKey(keys, policy))
+	app.Delete("/keys/:id", RevokeAPIKey(keys, policy))
+
+	tests := []struct {
+		name     string
+		caller   string
+		roles    []string
+		accounts []string
+		status   int
+	}{
+		{name: "viewer on an admin key", caller: "k_reader", roles: []string{"admin"}, accounts: []string{"acct_001"}, status: 403},
+		{name: "viewer on a wider role", caller: "k_reader", roles: []string{"finance"}, accounts: []string{"acct_001"}, status: 403},
+		{name: "viewer on a key for every account", caller: "k_reader", roles: []string{"viewer"}, accounts: []string{"*"}, status: 403},
+		{name: "viewer on another account's key", caller: "k_reader", roles: []string{"viewer"}, accounts: []string{"acct_002"}, status: 403},
+		{name: "viewer within its scope", caller: "k_reader", roles: []string{"viewer"}, accounts: []string{"acct_001", "acct_003"}, status: 200},
+		{name: "admin on every account", caller: "k_ops", roles: []string{"admin"}, accounts: []string{"*"}, status: 200},
+	}
+	for _, tt := range tests {
+		for _, action := range []struct{ method, path string }{{"POST", "/rotate"}, {"DELETE", ""}} {
+			t.Run(tt.name+" "+action.method, func(t *testing.T) {
+				key, _, err := keys.Create(context.Background(), "target", tt.roles, tt.accounts, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				status, body := send(t, app, action.method, "/keys/"+key.ID+action.path, tt.caller, "")
+				if status != tt.status {
+					t.Errorf("status = %d, want %d (%s)", status, tt.status, body)
+				}
+				if after, err := keys.Get(context.Background(), key.ID); err != nil {
+					t.Fatal(err)
+				} else if revoked := after.RevokedAt != nil; revoked != (action.method == "DELETE" && tt.status == 200) {
+					t.Errorf("revoked = %v", revoked)
+				}
+			})
+		}
+	}
+
+	if status, body := send(t, app, "DELETE", "/keys/key_missing", "k_ops", ""); status != 404 {
+		t.Errorf("unknown key: status = %d, want 404 (%s)", status, body)
+	}
+}
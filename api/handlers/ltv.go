@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+// LTV methods selectable on /api/metrics/ltv with ?method=.
+const (
+	ltvMethodFormula = "formula"
+	ltvMethodCohort  = "cohort"
+)
+
+const ltvCohortTTL = 30 * time.Minute
+
+// serveLTVCurves answers /api/metrics/ltv?method=cohort with empirical
+// cumulative revenue curves. Without an explicit range it looks at customers
+// acquired in the last two years, so the 365-day milestone can fill in.
+func serveLTVCurves(c *fiber.Ctx, cache *redis.Client, warehouse db.Warehouse, params metrics.Params) error {
+	const metric = "ltv"
+	if len(params.Filters) > 0 || c.Query("group_by") != "" || c.Query("compare") != "" {
+		return invalidParameter(c, metric, "filter, group_by and compare are not supported with method=cohort")
+	}
+	if params.Currency != db.DefaultCurrency {
+		return invalidParameter(c, metric, "method=cohort is only reported in "+db.DefaultCurrency)
+	}
+	if c.Query("start_date") == "" || c.Query("end_date") == "" {
+		now := time.Now().UTC()
+		params.StartDate = now.AddDate(-2, 0, 0).Format("2006-01-02")
+		params.EndDate = now.Format("2006-01-02")
+	}
+
+	cacheKey := metric + ":" + ltvMethodCohort + ":" + params.StartDate + ":" + params.EndDate + ":" + params.AccountID
+	return serveMetric(c, cache, metric, cacheKey, ltvCohortTTL, func(ctx context.Context) (MetricResponse, error) {
+		curves, err := reports.GetLTVCurves(ctx, warehouse, params)
+		if err != nil {
+			return MetricResponse{}, err
+		}
+		return MetricResponse{
+			Metric:     metric,
+			Value:      curves,
+			Unit:       db.UnitCurrency,
+			Currency:   db.DefaultCurrency,
+			TimeWindow: params.StartDate + " to " + params.EndDate,
+		}, nil
+	})
+}
@@ -2,6 +2,11 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"time"
 
@@ -9,283 +14,302 @@ import (
 	"github.com/redis/go-redis/v9"
 
 	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
 )
 
 type MetricResponse struct {
-	Metric     string      `json:"metric"`
-	Value      interface{} `json:"value"`
-	UpdatedAt  string      `json:"updated_at"`
-	Cached     bool        `json:"cached"`
-	TimeWindow string      `json:"time_window"`
+	Metric      string      `json:"metric"`
+	Value       interface{} `json:"value"`
+	Unit        string      `json:"unit,omitempty"`
+	Currency    string      `json:"currency,omitempty"`
+	Numerator   *float64    `json:"numerator,omitempty"`
+	Denominator *float64    `json:"denominator,omitempty"`
+	UpdatedAt   string      `json:"updated_at"`
+	Cached      bool        `json:"cached"`
+	TimeWindow  string      `json:"time_window"`
+	Granularity string      `json:"granularity,omitempty"`
+	Comparison  *Comparison `json:"comparison,omitempty"`
 }
 
-func GetRevenue(cache *redis.Client, warehouse *db.WarehouseClient) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		cacheKey := "revenue:" + startDate + ":" + endDate + ":" + accountID
-		if cached, ok := getCache(c.Context(), cache, cacheKey); ok {
-			return c.Status(http.StatusOK).JSON(MetricResponse{
-				Metric:     "revenue",
-				Value:      cached,
-				UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-				Cached:     true,
-				TimeWindow: startDate + " to " + endDate,
-			})
-		}
-
-		value := warehouse.GetRevenue(context.Background(), startDate, endDate, accountID)
-		setCache(c.Context(), cache, cacheKey, value, 5*time.Minute)
+// Comparison is the metric over the comparison window and the change from it
+// to the requested window. ChangePercent is omitted when the comparison value
+// is zero.
+type Comparison struct {
+	Value         float64  `json:"value"`
+	TimeWindow    string   `json:"time_window"`
+	Change        float64  `json:"change"`
+	ChangePercent *float64 `json:"change_percent,omitempty"`
+}
 
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "revenue",
-			Value:      value,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
-	}
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Metric  string `json:"metric,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
-func GetConversionRate(cache *redis.Client, warehouse *db.WarehouseClient) fiber.Handler {
+type metricQuery func(ctx context.Context) (MetricResponse, error)
+
+// GetMetric serves any metric from the registry at /api/metrics/:name. With
+// ?group_by=<dimension> it returns one row per dimension value instead of a
+// single number; with ?compare=previous_period|previous_year|<start>..<end>
+// it also reports the change from the comparison window. LTV also accepts
+// ?method=cohort for empirical curves instead of its formula. Currency
+// metrics are reported in ?currency=<ISO 4217 code> (default USD).
+func GetMetric(cache *redis.Client, registry *metrics.Registry, warehouse db.Warehouse) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		cacheKey := "conversion_rate:" + startDate + ":" + endDate + ":" + accountID
-		if cached, ok := getCache(c.Context(), cache, cacheKey); ok {
-			return c.Status(http.StatusOK).JSON(MetricResponse{
-				Metric:     "conversion_rate",
-				Value:      cached,
-				UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-				Cached:     true,
-				TimeWindow: startDate + " to " + endDate,
-			})
+		metric, ok := registry.Get(c.Params("name"))
+		if !ok {
+			return unknownMetric(c, c.Params("name"))
 		}
 
-		value := warehouse.GetConversionRate(context.Background(), startDate, endDate, accountID)
-		setCache(c.Context(), cache, cacheKey, value, 10*time.Minute)
-
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "conversion_rate",
-			Value:      value,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
-	}
-}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric.Name, err.Error())
+		}
+		switch method := c.Query("method", ltvMethodFormula); {
+		case method == ltvMethodFormula:
+		case method == ltvMethodCohort && metric.Name == "ltv":
+			return serveLTVCurves(c, cache, warehouse, params)
+		default:
+			return invalidParameter(c, metric.Name, "method "+method+" is not supported on "+metric.Name)
+		}
+		groupBy := c.Query("group_by")
+		compare := c.Query("compare")
+		pointInTime := registry.PointInTime(metric.Name)
+		cacheKey := metricCacheKey(c, metric.Name, params, pointInTime)
+		timeWindow := params.StartDate + " to " + params.EndDate
+		if pointInTime {
+			timeWindow = "current"
+		}
 
-func GetARPU(cache *redis.Client, warehouse *db.WarehouseClient) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		cacheKey := "arpu:" + startDate + ":" + endDate + ":" + accountID
-		if cached, ok := getCache(c.Context(), cache, cacheKey); ok {
-			return c.Status(http.StatusOK).JSON(MetricResponse{
-				Metric:     "arpu",
-				Value:      cached,
-				UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-				Cached:     true,
-				TimeWindow: startDate + " to " + endDate,
+		if groupBy != "" {
+			if compare != "" {
+				return invalidParameter(c, metric.Name, "compare is not supported with group_by")
+			}
+			cacheKey += ":by:" + groupBy
+			return serveMetric(c, cache, metric.Name, cacheKey, metric.TTL, func(ctx context.Context) (MetricResponse, error) {
+				rows, err := registry.Breakdown(ctx, warehouse, metric.Name, groupBy, params)
+				if err != nil {
+					return MetricResponse{}, err
+				}
+				return metricResponse(metric, rows, timeWindow, params.Currency), nil
 			})
 		}
 
-		value := warehouse.GetARPU(context.Background(), startDate, endDate, accountID)
-		setCache(c.Context(), cache, cacheKey, value, 10*time.Minute)
+		evaluate := func(p metrics.Params, timeWindow string) metricQuery {
+			return func(ctx context.Context) (MetricResponse, error) {
+				value, err := registry.Evaluate(ctx, warehouse, metric.Name, p)
+				if err != nil {
+					return MetricResponse{}, err
+				}
+				response := metricResponse(metric, value.Value, timeWindow, p.Currency)
+				response.Numerator = value.Numerator
+				response.Denominator = value.Denominator
+				return response, nil
+			}
+		}
+		if compare == "" {
+			return serveMetric(c, cache, metric.Name, cacheKey, metric.TTL, evaluate(params, timeWindow))
+		}
 
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "arpu",
-			Value:      value,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
+		if pointInTime {
+			return invalidParameter(c, metric.Name, "compare is not supported on point-in-time metrics")
+		}
+		previous, err := metrics.ComparisonParams(params, compare)
+		if err != nil {
+			return invalidParameter(c, metric.Name, err.Error())
+		}
+		response, err := cachedQuery(c.UserContext(), cache, cacheKey, metric.TTL, evaluate(params, timeWindow))
+		if err != nil {
+			return metricError(c, metric.Name, err)
+		}
+		previousWindow := previous.StartDate + " to " + previous.EndDate
+		prior, err := cachedQuery(c.UserContext(), cache, metricCacheKey(c, metric.Name, previous, false), metric.TTL, evaluate(previous, previousWindow))
+		if err != nil {
+			return metricError(c, metric.Name, err)
+		}
+		response.Comparison = comparison(response.Value, prior.Value, previousWindow)
+		response.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		return c.Status(http.StatusOK).JSON(response)
 	}
 }
 
-func GetMRR(cache *redis.Client, warehouse *db.WarehouseClient) fiber.Handler {
+// GetTrend serves the series of any registry metric at
+// /api/metrics/:name/trend, bucketed by
+// ?granularity=day|week|month|quarter|year (default day).
+func GetTrend(registry *metrics.Registry, warehouse db.Warehouse) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		accountID := resolveAccountID(c)
-
-		cacheKey := "mrr:" + accountID
-		if cached, ok := getCache(c.Context(), cache, cacheKey); ok {
-			return c.Status(http.StatusOK).JSON(MetricResponse{
-				Metric:     "mrr",
-				Value:      cached,
-				UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-				Cached:     true,
-				TimeWindow: "current",
-			})
-		}
-
-		value := warehouse.GetMRR(context.Background(), accountID)
-		setCache(c.Context(), cache, cacheKey, value, 15*time.Minute)
-
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "mrr",
-			Value:      value,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: "current",
-		})
+		return serveTrend(c, registry, warehouse, c.Params("name"))
 	}
 }
 
-func GetNRR(cache *redis.Client, warehouse *db.WarehouseClient) fiber.Handler {
+// GetNamedTrend serves the series of one fixed metric, for routes such as
+// /api/metrics/revenue-trend.
+func GetNamedTrend(registry *metrics.Registry, warehouse db.Warehouse, name string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		cacheKey := "nrr:" + startDate + ":" + endDate + ":" + accountID
-		if cached, ok := getCache(c.Context(), cache, cacheKey); ok {
-			return c.Status(http.StatusOK).JSON(MetricResponse{
-				Metric:     "nrr",
-				Value:      cached,
-				UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-				Cached:     true,
-				TimeWindow: startDate + " to " + endDate,
-			})
-		}
-
-		value := warehouse.GetNRR(context.Background(), startDate, endDate, accountID)
-		setCache(c.Context(), cache, cacheKey, value, 30*time.Minute)
-
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "nrr",
-			Value:      value,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
+		return serveTrend(c, registry, warehouse, name)
 	}
 }
 
-func GetChurnRate(cache *redis.Client, warehouse *db.WarehouseClient) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		cacheKey := "churn_rate:" + startDate + ":" + endDate + ":" + accountID
-		if cached, ok := getCache(c.Context(), cache, cacheKey); ok {
-			return c.Status(http.StatusOK).JSON(MetricResponse{
-				Metric:     "churn_rate",
-				Value:      cached,
-				UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-				Cached:     true,
-				TimeWindow: startDate + " to " + endDate,
-			})
-		}
-
-		value := warehouse.GetChurnRate(context.Background(), startDate, endDate, accountID)
-		setCache(c.Context(), cache, cacheKey, value, 30*time.Minute)
+func serveTrend(c *fiber.Ctx, registry *metrics.Registry, warehouse db.Warehouse, name string) error {
+	metric, ok := registry.Get(name)
+	if !ok {
+		return unknownMetric(c, name)
+	}
+	if c.Query("group_by") != "" {
+		return invalidParameter(c, metric.Name, "group_by is not supported on trend endpoints")
+	}
 
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "churn_rate",
-			Value:      value,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
+	params, err := resolveParams(c)
+	if err != nil {
+		return invalidParameter(c, metric.Name, err.Error())
+	}
+	granularity := c.Query("granularity", db.GranularityDay)
+	points, err := registry.Trend(c.UserContext(), warehouse, metric.Name, granularity, params)
+	if err != nil {
+		return metricError(c, metric.Name+"_trend", err)
 	}
+
+	response := metricResponse(metric, points, params.StartDate+" to "+params.EndDate, params.Currency)
+	response.Metric = metric.Name + "_trend"
+	response.Granularity = granularity
+	response.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return c.Status(http.StatusOK).JSON(response)
 }
 
-func GetLTV(cache *redis.Client, warehouse *db.WarehouseClient) fiber.Handler {
+func Health() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		cacheKey := "ltv:" + startDate + ":" + endDate + ":" + accountID
-		if cached, ok := getCache(c.Context(), cache, cacheKey); ok {
-			return c.Status(http.StatusOK).JSON(MetricResponse{
-				Metric:     "ltv",
-				Value:      cached,
-				UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-				Cached:     true,
-				TimeWindow: startDate + " to " + endDate,
-			})
-		}
-
-		value := warehouse.GetLTV(context.Background(), startDate, endDate, accountID)
-		setCache(c.Context(), cache, cacheKey, value, 30*time.Minute)
-
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "ltv",
-			Value:      value,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
+		return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
 	}
 }
 
-func GetCAC(cache *redis.Client, warehouse *db.WarehouseClient) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		cacheKey := "cac:" + startDate + ":" + endDate + ":" + accountID
-		if cached, ok := getCache(c.Context(), cache, cacheKey); ok {
-			return c.Status(http.StatusOK).JSON(MetricResponse{
-				Metric:     "cac",
-				Value:      cached,
-				UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-				Cached:     true,
-				TimeWindow: startDate + " to " + endDate,
-			})
-		}
+// serveMetric answers from cache when possible, otherwise runs query and
+// caches the response. Failed queries are reported and never cached.
+func serveMetric(c *fiber.Ctx, cache *redis.Client, metric, cacheKey string, ttl time.Duration, query metricQuery) error {
+	response, err := cachedQuery(c.UserContext(), cache, cacheKey, ttl, query)
+	if err != nil {
+		return metricError(c, metric, err)
+	}
+	response.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return c.Status(http.StatusOK).JSON(response)
+}
 
-		value := warehouse.GetCAC(context.Background(), startDate, endDate, accountID)
-		setCache(c.Context(), cache, cacheKey, value, 30*time.Minute)
+func cachedQuery(ctx context.Context, cache *redis.Client, cacheKey string, ttl time.Duration, query metricQuery) (MetricResponse, error) {
+	var response MetricResponse
+	if raw, ok := getCache(ctx, cache, cacheKey); ok && json.Unmarshal([]byte(raw), &response) == nil {
+		response.Cached = true
+		return response, nil
+	}
+	response, err := query(ctx)
+	if err != nil {
+		return MetricResponse{}, err
+	}
+	if raw, err := json.Marshal(response); err == nil {
+		setCache(ctx, cache, cacheKey, string(raw), ttl)
+	}
+	return response, nil
+}
 
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "cac",
-			Value:      value,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
+// metricCacheKey identifies one metric window, so a window is shared between
+// plain requests and comparisons that include it.
+func metricCacheKey(c *fiber.Ctx, metric string, p metrics.Params, pointInTime bool) string {
+	key := metric + ":" + p.StartDate + ":" + p.EndDate + ":" + p.AccountID
+	if pointInTime {
+		key = metric + ":" + p.AccountID
+	}
+	if filter := c.Query("filter"); filter != "" {
+		key += ":where:" + filter
 	}
+	if p.Currency != db.DefaultCurrency {
+		key += ":in:" + p.Currency
+	}
+	return key
 }
 
-func GetRevenueTrend(warehouse *db.WarehouseClient) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		points := warehouse.GetRevenueTrend(context.Background(), startDate, endDate, accountID)
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "revenue_trend",
-			Value:      points,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
+func comparison(value, previous interface{}, timeWindow string) *Comparison {
+	current, _ := value.(float64)
+	prior, _ := previous.(float64)
+	result := &Comparison{
+		Value:      prior,
+		TimeWindow: timeWindow,
+		Change:     math.Round((current-prior)*1e4) / 1e4,
 	}
+	if prior != 0 {
+		percent := math.Round((current-prior)/math.Abs(prior)*100*1e4) / 1e4
+		result.ChangePercent = &percent
+	}
+	return result
 }
 
-func GetConversionTrend(warehouse *db.WarehouseClient) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		startDate, endDate := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
-		accountID := resolveAccountID(c)
-
-		points := warehouse.GetConversionTrend(context.Background(), startDate, endDate, accountID)
-		return c.Status(http.StatusOK).JSON(MetricResponse{
-			Metric:     "conversion_trend",
-			Value:      points,
-			UpdatedAt:  time.Now().UTC().Format(time.RFC3339),
-			Cached:     false,
-			TimeWindow: startDate + " to " + endDate,
-		})
+func metricResponse(metric *metrics.Metric, value interface{}, timeWindow, currency string) MetricResponse {
+	response := MetricResponse{
+		Metric:     metric.Name,
+		Value:      value,
+		Unit:       metric.Unit,
+		TimeWindow: timeWindow,
+	}
+	if metric.Unit == db.UnitCurrency {
+		response.Currency = currency
 	}
+	return response
 }
 
-func Health() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		return c.Status(http.StatusOK).JSON(fiber.Map{"status": "ok"})
+func unknownMetric(c *fiber.Ctx, name string) error {
+	return c.Status(http.StatusNotFound).JSON(ErrorResponse{
+		Error:  "unknown_metric",
+		Metric: name,
+	})
+}
+
+func invalidParameter(c *fiber.Ctx, metric, message string) error {
+	return c.Status(http.StatusBadRequest).JSON(ErrorResponse{
+		Error:   "invalid_parameter",
+		Metric:  metric,
+		Message: message,
+	})
+}
+
+// metricError reports invalid requests as 400, unknown accounts as 404 and
+// anything else as a warehouse failure.
+func metricError(c *fiber.Ctx, metric string, err error) error {
+	if errors.Is(err, reports.ErrUnknownAccount) {
+		return unknownAccount(c, metric)
 	}
+	for _, invalid := range []error{
+		metrics.ErrTrendUnsupported,
+		metrics.ErrUnknownDimension,
+		metrics.ErrDimensionUnsupported,
+		metrics.ErrInvalidFilter,
+		metrics.ErrFilterUnsupported,
+		metrics.ErrUnknownGranularity,
+		metrics.ErrInvalidDateRange,
+		metrics.ErrInvalidCurrency,
+		metrics.ErrUnknownCurrency,
+		metrics.ErrMissingRate,
+		reports.ErrUnknownPeriod,
+		reports.ErrUnknownModel,
+		reports.ErrUnknownProductSort,
+		reports.ErrUnknownAccountSort,
+		reports.ErrHiddenAccountSort,
+		reports.ErrUnknownOrder,
+		reports.ErrUnknownOrderSort,
+		reports.ErrInvalidCursor,
+	} {
+		if errors.Is(err, invalid) {
+			return invalidParameter(c, metric, err.Error())
+		}
+	}
+	return warehouseError(c, metric, err)
+}
+
+func warehouseError(c *fiber.Ctx, metric string, err error) error {
+	log.Printf("warehouse query for %s failed: %v", metric, err)
+	return c.Status(http.StatusBadGateway).JSON(ErrorResponse{
+		Error:   "warehouse_error",
+		Metric:  metric,
+		Message: "the warehouse query failed",
+	})
 }
 
 func getCache(ctx context.Context, client *redis.Client, key string) (string, bool) {
@@ -309,12 +333,41 @@ func resolveAccountID(c *fiber.Ctx) string {
 	return c.Query("account_id")
 }
 
-func resolveDateRange(startDate, endDate string) (string, string) {
-	if startDate == "" || endDate == "" {
+func resolveParams(c *fiber.Ctx) (metrics.Params, error) {
+	startDate, endDate, err := resolveDateRange(c.Query("start_date"), c.Query("end_date"))
+	if err != nil {
+		return metrics.Params{}, err
+	}
+	filters, err := metrics.ParseFilters(c.Query("filter"))
+	if err != nil {
+		return metrics.Params{}, err
+	}
+	currency, err := metrics.ParseCurrency(c.Query("currency"))
+	if err != nil {
+		return metrics.Params{}, err
+	}
+	return metrics.Params{
+		StartDate: startDate,
+		EndDate:   endDate,
+		AccountID: resolveAccountID(c),
+		Filters:   filters,
+		Currency:  currency,
+	}, nil
+}
+
+// resolveDateRange defaults the window to the last 30 days when neither
+// bound is given. A single bound, an unparsable date or a reversed range is
+// an error rather than falling back to the default.
+func resolveDateRange(startDate, endDate string) (string, string, error) {
+	if startDate == "" && endDate == "" {
 		now := time.Now().UTC()
-		endDate = now.Format("2006-01-02")
-		startDate = now.AddDate(0, 0, -30).Format("2006-01-02")
-		return startDate, endDate
+		return now.AddDate(0, 0, -30).Format("2006-01-02"), now.Format("2006-01-02"), nil
+	}
+	if startDate == "" || endDate == "" {
+		return "", "", fmt.Errorf("%w: set both start_date and end_date, or neither", metrics.ErrInvalidDateRange)
+	}
+	if _, _, err := metrics.ParseDateRange(startDate, endDate); err != nil {
+		return "", "", err
 	}
-	return startDate, endDate
+	return startDate, endDate, nil
 }
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+)
+
+func TestDateRangeParameters(t *testing.T) {
+	registry := metrics.NewRegistry()
+	warehouse := sqlitetest.Open(t)
+	app := fiber.New()
+	app.Get("/metrics/:name/trend", GetTrend(registry, warehouse))
+	app.Get("/metrics/:name", GetMetric(noCache(), registry, warehouse))
+	app.Get("/cohorts/retention", GetCohortRetention(noCache(), warehouse))
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "default window", path: "/metrics/revenue", status: 200},
+		{name: "both bounds", path: "/metrics/revenue?start_date=2026-01-01&end_date=2026-01-31", status: 200},
+		{name: "one-day window", path: "/metrics/revenue?start_date=2026-01-01&end_date=2026-01-01", status: 200},
+		{name: "only start", path: "/metrics/revenue?start_date=2026-01-01", status: 400},
+		{name: "only end", path: "/metrics/revenue?end_date=2026-01-31", status: 400},
+		{name: "malformed start alone", path: "/metrics/revenue?start_date=bad", status: 400},
+		{name: "malformed start", path: "/metrics/revenue?start_date=bad&end_date=2026-01-31", status: 400},
+		{name: "malformed end", path: "/metrics/revenue?start_date=2026-01-01&end_date=31/01/2026", status: 400},
+		{name: "impossible date", path: "/metrics/revenue?start_date=2026-02-30&end_date=2026-03-31", status: 400},
+		{name: "reversed", path: "/metrics/revenue?start_date=2026-01-31&end_date=2026-01-01", status: 400},
+		{name: "trend with only start", path: "/metrics/revenue/trend?start_date=2026-01-01", status: 400},
+		{name: "cohorts with only end", path: "/cohorts/retention?end_date=2026-01-31", status: 400},
+		{name: "cohorts default window", path: "/cohorts/retention", status: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := send(t, app, "GET", tt.path, "", "")
+			if status != tt.status {
+				t.Errorf("status = %d, want %d (%s)", status, tt.status, body)
+			}
+		})
+	}
+}
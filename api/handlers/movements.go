@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/reports"
+)
+
+const mrrMovementsTTL = 30 * time.Minute
+
+// GetMRRMovements serves the MRR bridge (new, expansion, reactivation,
+// contraction and churn) for the requested window and account. With
+// ?granularity=day|week|month|quarter|year it returns a bridge per period.
+func GetMRRMovements(cache *redis.Client, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "mrr_movements"
+		if c.Query("filter") != "" || c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "filter and group_by are not supported on mrr-movements")
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+		if params.Currency != db.DefaultCurrency {
+			return invalidParameter(c, metric, "mrr-movements is only reported in "+db.DefaultCurrency)
+		}
+
+		cacheKey := metric + ":" + params.StartDate + ":" + params.EndDate + ":" + params.AccountID
+		if granularity := c.Query("granularity"); granularity != "" {
+			return serveMetric(c, cache, metric, cacheKey+":by:"+granularity, mrrMovementsTTL, func(ctx context.Context) (MetricResponse, error) {
+				points, err := reports.GetMRRMovementsTrend(ctx, warehouse, granularity, params)
+				if err != nil {
+					return MetricResponse{}, err
+				}
+				return MetricResponse{
+					Metric:      metric,
+					Value:       points,
+					Unit:        db.UnitCurrency,
+					Currency:    db.DefaultCurrency,
+					TimeWindow:  params.StartDate + " to " + params.EndDate,
+					Granularity: granularity,
+				}, nil
+			})
+		}
+		return serveMetric(c, cache, metric, cacheKey, mrrMovementsTTL, func(ctx context.Context) (MetricResponse, error) {
+			movements, err := reports.GetMRRMovements(ctx, warehouse, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      movements,
+				Unit:       db.UnitCurrency,
+				Currency:   db.DefaultCurrency,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+const (
+	ordersTTL         = 5 * time.Minute
+	defaultOrderLimit = 50
+	maxOrderLimit     = 500
+)
+
+// GetOrders serves the fact_orders rows behind the revenue metric at
+// /api/orders, for the same window, filter and currency parameters. Rows
+// are sorted by ?sort=order_date|amount (default order_date) in
+// ?order=asc|desc (default desc), ?limit (default 50) at a time; pass the
+// next_cursor of a page as ?cursor to get the next one.
+func GetOrders(cache *redis.Client, registry *metrics.Registry, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "orders"
+		if c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "group_by is not supported on orders")
+		}
+		sortBy := c.Query("sort", reports.OrderSortDate)
+		order := c.Query("order", reports.SortDescending)
+		cursor := c.Query("cursor")
+		limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultOrderLimit)))
+		if err != nil || limit < 1 || limit > maxOrderLimit {
+			return invalidParameter(c, metric, "limit must be between 1 and "+strconv.Itoa(maxOrderLimit))
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+
+		cacheKey := metricCacheKey(c, metric, params, false) + ":" + sortBy + ":" + order + ":" + strconv.Itoa(limit) + ":" + cursor
+		return serveMetric(c, cache, metric, cacheKey, ordersTTL, func(ctx context.Context) (MetricResponse, error) {
+			page, err := reports.GetOrders(ctx, registry, warehouse, sortBy, order, cursor, limit, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      page,
+				Unit:       db.UnitCurrency,
+				Currency:   params.Currency,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
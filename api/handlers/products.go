@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/reports"
+)
+
+const (
+	productsTTL         = 15 * time.Minute
+	defaultProductLimit = 10
+	maxProductLimit     = 100
+)
+
+// GetTopProducts serves the products with the most ?sort=revenue|orders
+// (default revenue) in the window at /api/products, up to ?limit (default
+// 10), with their average price per order against the list price.
+func GetTopProducts(cache *redis.Client, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "top_products"
+		if c.Query("filter") != "" || c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "filter and group_by are not supported on products")
+		}
+		sortBy := c.Query("sort", reports.ProductSortRevenue)
+		limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultProductLimit)))
+		if err != nil || limit < 1 || limit > maxProductLimit {
+			return invalidParameter(c, metric, "limit must be between 1 and "+strconv.Itoa(maxProductLimit))
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+		if params.Currency != db.DefaultCurrency {
+			return invalidParameter(c, metric, "products are only reported in "+db.DefaultCurrency)
+		}
+
+		cacheKey := metric + ":" + sortBy + ":" + strconv.Itoa(limit) + ":" + params.StartDate + ":" + params.EndDate + ":" + params.AccountID
+		return serveMetric(c, cache, metric, cacheKey, productsTTL, func(ctx context.Context) (MetricResponse, error) {
+			products, err := reports.GetTopProducts(ctx, warehouse, sortBy, limit, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      products,
+				Unit:       db.UnitCurrency,
+				Currency:   db.DefaultCurrency,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
+
+// GetCategoryMix serves revenue split by product category per bucket at
+// /api/products/category-mix, bucketed by
+// ?granularity=day|week|month|quarter|year (default month).
+func GetCategoryMix(cache *redis.Client, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "category_mix"
+		if c.Query("filter") != "" || c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "filter and group_by are not supported on products")
+		}
+		granularity := c.Query("granularity", db.GranularityMonth)
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+		if params.Currency != db.DefaultCurrency {
+			return invalidParameter(c, metric, "products are only reported in "+db.DefaultCurrency)
+		}
+
+		cacheKey := metric + ":" + granularity + ":" + params.StartDate + ":" + params.EndDate + ":" + params.AccountID
+		return serveMetric(c, cache, metric, cacheKey, productsTTL, func(ctx context.Context) (MetricResponse, error) {
+			mix, err := reports.GetCategoryMix(ctx, warehouse, granularity, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:      metric,
+				Value:       mix,
+				Unit:        db.UnitCurrency,
+				Currency:    db.DefaultCurrency,
+				TimeWindow:  params.StartDate + " to " + params.EndDate,
+				Granularity: granularity,
+			}, nil
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+const revenueBreakdownTTL = 5 * time.Minute
+
+// GetRevenueBreakdown serves gross revenue, discounts, refunds, tax and net
+// revenue with the refund and discount rates at
+// /api/metrics/revenue-breakdown. It accepts the filter and currency
+// parameters of the revenue metric.
+func GetRevenueBreakdown(cache *redis.Client, registry *metrics.Registry, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "revenue_breakdown"
+		if c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "group_by is not supported on revenue-breakdown")
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+
+		cacheKey := metricCacheKey(c, metric, params, false)
+		return serveMetric(c, cache, metric, cacheKey, revenueBreakdownTTL, func(ctx context.Context) (MetricResponse, error) {
+			breakdown, err := reports.GetRevenueBreakdown(ctx, registry, warehouse, params)
+			if err != nil {
+				return MetricResponse{}, err
+			}
+			return MetricResponse{
+				Metric:     metric,
+				Value:      breakdown,
+				Unit:       db.UnitCurrency,
+				Currency:   params.Currency,
+				TimeWindow: params.StartDate + " to " + params.EndDate,
+			}, nil
+		})
+	}
+}
+
+// GetRevenueBreakdownTrend serves the breakdown per bucket at
+// /api/metrics/revenue-breakdown/trend, bucketed by
+// ?granularity=day|week|month|quarter|year (default day).
+func GetRevenueBreakdownTrend(registry *metrics.Registry, warehouse db.Warehouse) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		const metric = "revenue_breakdown_trend"
+		if c.Query("group_by") != "" {
+			return invalidParameter(c, metric, "group_by is not supported on trend endpoints")
+		}
+		params, err := resolveParams(c)
+		if err != nil {
+			return invalidParameter(c, metric, err.Error())
+		}
+		granularity := c.Query("granularity", db.GranularityDay)
+		points, err := reports.GetRevenueBreakdownTrend(c.UserContext(), registry, warehouse, granularity, params)
+		if err != nil {
+			return metricError(c, metric, err)
+		}
+
+		return c.Status(http.StatusOK).JSON(MetricResponse{
+			Metric:      metric,
+			Value:       points,
+			Unit:        db.UnitCurrency,
+			Currency:    params.Currency,
+			UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+			TimeWindow:  params.StartDate + " to " + params.EndDate,
+			Granularity: granularity,
+		})
+	}
+}
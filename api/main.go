@@ -7,41 +7,107 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/redis/go-redis/v9"
 
+	"revenue-dashboard-api/apikeys"
+	"revenue-dashboard-api/audit"
 	"revenue-dashboard-api/cache"
 	"revenue-dashboard-api/db"
+	_ "revenue-dashboard-api/db/bigquery"
+	_ "revenue-dashboard-api/db/postgres"
+	_ "revenue-dashboard-api/db/sqlite"
 	"revenue-dashboard-api/handlers"
+	"revenue-dashboard-api/metrics"
 	"revenue-dashboard-api/middleware"
+	"revenue-dashboard-api/ratelimit"
 )
 
 func main() {
-	app := fiber.New()
+	redisClient := cache.NewRedisClient()
+	keys := apikeys.NewStore()
+	defer func() {
+		_ = keys.Close()
+	}()
+	auditLog := audit.NewLog()
+	defer func() {
+		_ = auditLog.Close()
+	}()
+	warehouse := db.NewWarehouseClient()
+	defer func() {
+		_ = warehouse.Close()
+	}()
+	issuer := middleware.NewTestIssuer()
 
+	app := fiber.New()
 	app.Use(logger.New())
+	routes(app, services{
+		redis:     redisClient,
+		registry:  metrics.NewRegistry(),
+		policy:    middleware.NewPolicy(),
+		issuer:    issuer,
+		tokens:    middleware.NewTokenVerifierFromEnv(issuer),
+		keys:      keys,
+		auditLog:  auditLog,
+		warehouse: warehouse,
+	})
+
+	log.Fatal(app.Listen(":8080"))
+}
+
+// services are what the API serves requests from.
+type services struct {
+	redis     *redis.Client
+	registry  *metrics.Registry
+	policy    *middleware.Policy
+	issuer    *middleware.TestIssuer
+	tokens    *middleware.TokenVerifier
+	keys      *apikeys.Store
+	auditLog  *audit.Log
+	warehouse db.Warehouse
+}
+
+func routes(app *fiber.App, s services) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: os.Getenv("ALLOWED_ORIGINS"),
 	}))
 
-	redisClient := cache.NewRedisClient()
-	warehouse := db.NewWarehouseClient()
-	defer func() {
-		_ = warehouse.Close()
-	}()
+	if s.issuer != nil {
+		app.Get("/auth/test/jwks.json", s.issuer.JWKSHandler())
+		app.Post("/auth/test/token", s.issuer.TokenHandler())
+		app.Post("/auth/test/rotate", s.issuer.RotateHandler())
+	}
 
 	api := app.Group("/api")
-	api.Use(middleware.AuthMiddleware())
-
-	api.Get("/metrics/revenue", handlers.GetRevenue(redisClient, warehouse))
-	api.Get("/metrics/conversion-rate", handlers.GetConversionRate(redisClient, warehouse))
-	api.Get("/metrics/arpu", handlers.GetARPU(redisClient, warehouse))
-	api.Get("/metrics/mrr", handlers.GetMRR(redisClient, warehouse))
-	api.Get("/metrics/nrr", handlers.GetNRR(redisClient, warehouse))
-	api.Get("/metrics/churn-rate", handlers.GetChurnRate(redisClient, warehouse))
-	api.Get("/metrics/ltv", handlers.GetLTV(redisClient, warehouse))
-	api.Get("/metrics/cac", handlers.GetCAC(redisClient, warehouse))
-	api.Get("/metrics/revenue-trend", handlers.GetRevenueTrend(warehouse))
-	api.Get("/metrics/conversion-trend", handlers.GetConversionTrend(warehouse))
-	api.Get("/health", handlers.Health())
+	api.Use(middleware.Audit(s.auditLog))
+	api.Use(middleware.AuthMiddleware(s.policy, s.tokens, s.keys))
+	limits := middleware.NewRateLimits(ratelimit.NewLimiter(s.redis))
+	api.Use(limits.Callers())
 
-	log.Fatal(app.Listen(":8080"))
+	// Each route declares the metric families it reads for EnforceRBAC;
+	// those reading accounts then count against the account's rate limit.
+	revenue := middleware.Family("revenue")
+	admin := middleware.Family("admin")
+	limitAccount := limits.Accounts()
+
+	api.Get("/metrics/revenue-trend", middleware.EnforceRBAC(middleware.NamedMetricFamily(s.registry, "revenue")), limitAccount, handlers.GetNamedTrend(s.registry, s.warehouse, "revenue"))
+	api.Get("/metrics/conversion-trend", middleware.EnforceRBAC(middleware.NamedMetricFamily(s.registry, "conversion_rate")), limitAccount, handlers.GetNamedTrend(s.registry, s.warehouse, "conversion_rate"))
+	api.Get("/metrics/revenue-breakdown", middleware.EnforceRBAC(revenue), limitAccount, handlers.GetRevenueBreakdown(s.redis, s.registry, s.warehouse))
+	api.Get("/metrics/revenue-breakdown/trend", middleware.EnforceRBAC(revenue), limitAccount, handlers.GetRevenueBreakdownTrend(s.registry, s.warehouse))
+	api.Get("/metrics/mrr-movements", middleware.EnforceRBAC(middleware.Family("subscription")), limitAccount, handlers.GetMRRMovements(s.redis, s.warehouse))
+	api.Get("/metrics/:name/trend", middleware.EnforceRBAC(middleware.MetricFamily(s.registry)), limitAccount, handlers.GetTrend(s.registry, s.warehouse))
+	api.Get("/metrics/:name", middleware.EnforceRBAC(middleware.MetricFamily(s.registry)), limitAccount, handlers.GetMetric(s.redis, s.registry, s.warehouse))
+	api.Get("/cohorts/retention", middleware.EnforceRBAC(middleware.Family("engagement")), limitAccount, handlers.GetCohortRetention(s.redis, s.warehouse))
+	api.Get("/funnels/:name", middleware.EnforceRBAC(middleware.Family("engagement")), limitAccount, handlers.GetFunnel(s.redis, s.registry, s.warehouse))
+	api.Get("/attribution", middleware.EnforceRBAC(middleware.Family("marketing")), limitAccount, handlers.GetAttribution(s.redis, s.warehouse))
+	api.Get("/products", middleware.EnforceRBAC(revenue), limitAccount, handlers.GetTopProducts(s.redis, s.warehouse))
+	api.Get("/products/category-mix", middleware.EnforceRBAC(revenue), limitAccount, handlers.GetCategoryMix(s.redis, s.warehouse))
+	api.Get("/accounts", middleware.EnforceRBACListing(revenue), limitAccount, handlers.GetAccounts(s.redis, s.warehouse))
+	api.Get("/accounts/:account_id", middleware.EnforceRBAC(revenue), limitAccount, handlers.GetAccount(s.redis, s.registry, s.warehouse))
+	api.Get("/orders", middleware.EnforceRBAC(revenue), limitAccount, handlers.GetOrders(s.redis, s.registry, s.warehouse))
+	api.Get("/admin/keys", middleware.EnforceRBAC(admin), handlers.ListAPIKeys(s.keys))
+	api.Post("/admin/keys", middleware.EnforceRBAC(admin), handlers.CreateAPIKey(s.keys, s.policy))
+	api.Post("/admin/keys/:id/rotate", middleware.EnforceRBAC(admin), handlers.RotateAPIKey(s.keys, s.policy))
+	api.Delete("/admin/keys/:id", middleware.EnforceRBAC(admin), handlers.RevokeAPIKey(s.keys, s.policy))
+	api.Get("/admin/audit", middleware.EnforceRBAC(admin), handlers.GetAuditLog(s.auditLog))
+	api.Get("/health", handlers.Health())
 }
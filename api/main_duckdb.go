@@ -0,0 +1,7 @@
+//go:build duckdb
+
+package main
+
+import (
+	_ "revenue-dashboard-api/db/duckdb"
+)
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"revenue-dashboard-api/apikeys/apikeystest"
+	"revenue-dashboard-api/audit/audittest"
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/middleware"
+)
+
+// testApp serves the API from the seeded SQLite warehouse under the bundled
+// policy, with Redis unreachable so nothing is cached.
+func testApp(t *testing.T) *fiber.App {
+	t.Helper()
+	policy, err := middleware.LoadPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	routes(app, services{
+		redis:     redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}),
+		registry:  metrics.NewRegistry(),
+		policy:    policy,
+		keys:      apikeystest.Open(t),
+		auditLog:  audittest.Open(t),
+		warehouse: sqlitetest.Open(t),
+	})
+	return app
+}
+
+// get sends a GET with the API key, if any, and returns the status and body.
+func get(t *testing.T, app *fiber.App, path, key string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, raw
+}
+
+// dashboardPaths are the requests frontend/pages/index.tsx makes.
+var dashboardPaths = []string{
+	"/api/metrics/revenue?compare=previous_period",
+	"/api/metrics/conversion-rate?compare=previous_period",
+	"/api/metrics/arpu?compare=previous_period",
+	"/api/metrics/mrr",
+	"/api/metrics/nrr?compare=previous_period",
+	"/api/metrics/churn-rate?compare=previous_period",
+	"/api/metrics/ltv?compare=previous_period",
+	"/api/metrics/cac?compare=previous_period",
+	"/api/metrics/revenue-trend",
+	"/api/metrics/conversion-trend",
+}
+
+func TestDashboardUnderDefaultPolicy(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "")
+	app := testApp(t)
+
+	for _, path := range dashboardPaths {
+		t.Run(path, func(t *testing.T) {
+			status, raw := get(t, app, path, "")
+			if status != 200 {
+				t.Fatalf("status = %d, want 200 (%s)", status, raw)
+			}
+			var body struct {
+				Value interface{} `json:"value"`
+			}
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Fatal(err)
+			}
+			switch value := body.Value.(type) {
+			case float64:
+			case []interface{}:
+				if len(value) == 0 {
+					t.Error("empty trend")
+				}
+			default:
+				t.Errorf("value = %v, want a number or a trend", body.Value)
+			}
+		})
+	}
+}
+
+func TestDefaultPolicyAccess(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "viewerkey:*")
+	app := testApp(t)
+
+	tests := []struct {
+		name   string
+		key    string
+		path   string
+		status int
+	}{
+		{name: "missing key", path: "/api/metrics/revenue", status: 401},
+		{name: "viewer reads revenue", key: "viewerkey", path: "/api/metrics/revenue", status: 200},
+		{name: "viewer cannot read subscriptions", key: "viewerkey", path: "/api/metrics/mrr", status: 403},
+		{name: "viewer reads the leaderboard", key: "viewerkey", path: "/api/accounts", status: 200},
+		{name: "viewer reads an account", key: "viewerkey", path: "/api/accounts/acct_001", status: 200},
+		{name: "viewer cannot sort by mrr", key: "viewerkey", path: "/api/accounts?sort=mrr", status: 400},
+		{name: "viewer cannot read marketing", key: "viewerkey", path: "/api/metrics/cac", status: 403},
+		{name: "viewer cannot manage keys", key: "viewerkey", path: "/api/admin/keys", status: 403},
+		{name: "viewer cannot read the audit log", key: "viewerkey", path: "/api/admin/audit", status: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, raw := get(t, app, tt.path, tt.key); status != tt.status {
+				t.Errorf("status = %d, want %d (%s)", status, tt.status, raw)
+			}
+		})
+	}
+}
+
+func TestAnonymousCannotAdminister(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "")
+	app := testApp(t)
+
+	for _, path := range []string{"/api/admin/keys", "/api/admin/audit"} {
+		if status, _ := get(t, app, path, ""); status != 403 {
+			t.Errorf("%s: status = %d, want 403", path, status)
+		}
+	}
+}
+
+func TestLeaderboardFieldsFollowFamilies(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "viewerkey:*")
+	app := testApp(t)
+
+	status, raw := get(t, app, "/api/accounts", "viewerkey")
+	if status != 200 {
+		t.Fatalf("status = %d, want 200 (%s)", status, raw)
+	}
+	var body struct {
+		Value struct {
+			Accounts []map[string]interface{} `json:"accounts"`
+		} `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Value.Accounts) == 0 {
+		t.Fatal("no accounts")
+	}
+	for _, account := range body.Value.Accounts {
+		for field, want := range map[string]bool{"revenue": true, "active_users": true, "mrr": false, "mrr_change": false} {
+			if _, ok := account[field]; ok != want {
+				t.Errorf("%v: %s present = %v, want %v", account["account_id"], field, ok, want)
+			}
+		}
+	}
+}
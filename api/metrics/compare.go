@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"revenue-dashboard-api/db"
+)
+
+const (
+	ComparePreviousPeriod = "previous_period"
+	ComparePreviousYear   = "previous_year"
+)
+
+// ComparisonParams returns p moved to the comparison window named by
+// compare: the equally long window ending the day before p starts, the same
+// dates one year earlier, or an explicit "YYYY-MM-DD..YYYY-MM-DD" range.
+func ComparisonParams(p Params, compare string) (Params, error) {
+	start, err := time.Parse("2006-01-02", p.StartDate)
+	if err != nil {
+		return Params{}, fmt.Errorf("%w: start_date must be YYYY-MM-DD", ErrInvalidDateRange)
+	}
+	end, err := time.Parse("2006-01-02", p.EndDate)
+	if err != nil {
+		return Params{}, fmt.Errorf("%w: end_date must be YYYY-MM-DD", ErrInvalidDateRange)
+	}
+
+	switch compare {
+	case ComparePreviousPeriod:
+		days := int(end.Sub(start).Hours() / 24)
+		end = start.AddDate(0, 0, -1)
+		start = end.AddDate(0, 0, -days)
+	case ComparePreviousYear:
+		start = start.AddDate(-1, 0, 0)
+		end = end.AddDate(-1, 0, 0)
+	default:
+		from, to, ok := strings.Cut(compare, "..")
+		if !ok {
+			return Params{}, fmt.Errorf("%w: compare must be previous_period, previous_year or YYYY-MM-DD..YYYY-MM-DD", ErrInvalidDateRange)
+		}
+		if start, err = time.Parse("2006-01-02", from); err != nil {
+			return Params{}, fmt.Errorf("%w: compare start must be YYYY-MM-DD", ErrInvalidDateRange)
+		}
+		if end, err = time.Parse("2006-01-02", to); err != nil {
+			return Params{}, fmt.Errorf("%w: compare end must be YYYY-MM-DD", ErrInvalidDateRange)
+		}
+	}
+	if end.Before(start) {
+		return Params{}, fmt.Errorf("%w: compare window ends before it starts", ErrInvalidDateRange)
+	}
+
+	p.StartDate = db.FormatDate(start)
+	p.EndDate = db.FormatDate(end)
+	return p, nil
+}
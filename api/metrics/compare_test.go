@@ -0,0 +1,78 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+)
+
+func TestComparisonParams(t *testing.T) {
+	p := metrics.Params{StartDate: "2026-03-01", EndDate: "2026-03-31", AccountID: "acct_001"}
+	tests := []struct {
+		compare    string
+		start, end string
+		err        bool
+	}{
+		{compare: metrics.ComparePreviousPeriod, start: "2026-01-29", end: "2026-02-28"},
+		{compare: metrics.ComparePreviousYear, start: "2025-03-01", end: "2025-03-31"},
+		{compare: "2025-12-01..2025-12-31", start: "2025-12-01", end: "2025-12-31"},
+		{compare: "last_month", err: true},
+		{compare: "2025-12-31..2025-12-01", err: true},
+		{compare: "2025-12-01..yesterday", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compare, func(t *testing.T) {
+			got, err := metrics.ComparisonParams(p, tt.compare)
+			if tt.err {
+				if !errors.Is(err, metrics.ErrInvalidDateRange) {
+					t.Errorf("err = %v, want ErrInvalidDateRange", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.StartDate != tt.start || got.EndDate != tt.end || got.AccountID != p.AccountID {
+				t.Errorf("params = %+v, want %s to %s for %s", got, tt.start, tt.end, p.AccountID)
+			}
+		})
+	}
+}
+
+func TestComparisonValues(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+
+	// The ten days before the last ten hold orders 10 to 19.
+	previous, err := metrics.ComparisonParams(metrics.Params{StartDate: day(-9), EndDate: day(0)}, metrics.ComparePreviousPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.StartDate != day(-19) || previous.EndDate != day(-10) {
+		t.Fatalf("previous period %s to %s, want %s to %s", previous.StartDate, previous.EndDate, day(-19), day(-10))
+	}
+	tests := []struct {
+		metric string
+		want   float64
+	}{
+		{metric: "revenue", want: 13625},
+		{metric: "mrr_start", want: 2610},
+		{metric: "mrr_end", want: 2700},
+		{metric: "marketing_spend", want: 3725},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			value, err := registry.Evaluate(ctx, warehouse, tt.metric, previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value.Value != tt.want {
+				t.Errorf("value = %v, want %v", value.Value, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"revenue-dashboard-api/db"
+)
+
+var (
+	ErrInvalidCurrency = errors.New("currency must be a three-letter ISO 4217 code")
+	ErrUnknownCurrency = errors.New("no exchange rates for currency")
+	ErrMissingRate     = errors.New("no exchange rate into " + db.DefaultCurrency)
+)
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// exchangeRates holds one rate per currency pair and day: one unit of
+// from_currency is worth rate units of to_currency. Conversions go through
+// the default currency, so only rates into it are needed.
+const exchangeRates = "dim_exchange_rates"
+
+// ParseCurrency reads the currency query parameter; empty means the default
+// currency.
+func ParseCurrency(raw string) (string, error) {
+	if raw == "" {
+		return db.DefaultCurrency, nil
+	}
+	code := strings.ToUpper(strings.TrimSpace(raw))
+	if !currencyCode.MatchString(code) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, raw)
+	}
+	return code, nil
+}
+
+// ReportingCurrency is the currency amounts are reported in.
+func (p Params) ReportingCurrency() string {
+	if p.Currency == "" {
+		return db.DefaultCurrency
+	}
+	return p.Currency
+}
+
+// checkCurrency rejects reporting a currency metric in a currency the
+// exchange-rate table has no rates for, rather than reporting zero. It also
+// rejects windows with rows the metric would convert but has no rate for,
+// in their own currency or the reporting one, since those rows would drop
+// out of the sum.
+func (r *Registry) checkCurrency(ctx context.Context, warehouse db.Warehouse, metric *Metric, p Params) error {
+	target := p.ReportingCurrency()
+	if metric.Unit == db.UnitCurrency && target != db.DefaultCurrency {
+		b := db.NewBuilder(warehouse.Dialect())
+		query := "select min(rate_date) as first_rate from " + warehouse.Dialect().Table(exchangeRates) +
+			" where from_currency = " + b.Arg(target) + " and to_currency = " + b.Arg(db.DefaultCurrency)
+		rows, err := warehouse.Query(ctx, query, b.Args()...)
+		if err != nil {
+			return fmt.Errorf("exchange rates: %w", err)
+		}
+		if len(rows) == 0 || rows[0]["first_rate"] == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownCurrency, target)
+		}
+		if first := rows[0].Date("first_rate"); r.dated(metric) && first > p.StartDate {
+			return fmt.Errorf("%w: %s before %s", ErrMissingRate, target, first)
+		}
+	}
+
+	checked := map[string]bool{}
+	for _, base := range r.bases(metric) {
+		column := r.currencies[base.Table]
+		if column == "" || !r.converts(base, p) || checked[base.Table] {
+			continue
+		}
+		checked[base.Table] = true
+		if err := CheckRates(ctx, warehouse, base.Table, column, base.DateColumn, p.StartDate, p.EndDate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bases lists the base metrics a metric is computed from: itself, its
+// dependencies' bases, or those of the metric its trend charts.
+func (r *Registry) bases(m *Metric) []*Metric {
+	if !m.Derived() {
+		bases := []*Metric{m}
+		if m.Trend != "" {
+			bases = append(bases, r.bases(r.metrics[m.Trend])...)
+		}
+		return bases
+	}
+	var bases []*Metric
+	for _, dep := range m.deps {
+		bases = append(bases, r.bases(r.metrics[dep])...)
+	}
+	return bases
+}
+
+// dated reports whether any of a metric's bases converts at row dates
+// rather than the latest rates.
+func (r *Registry) dated(m *Metric) bool {
+	for _, base := range r.bases(m) {
+		if base.DateColumn != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRates confirms that every row of table dated from start to end can
+// be converted into the default currency: the currency named by its currency
+// column needs a rate on or before the row's date column, or any rate when
+// date is empty. An empty start or end leaves that side of the window open.
+// Since each rate holds until the next, only a currency's first rate
+// matters. Rows without a rate would drop out of converted sums, so they are
+// reported as ErrMissingRate.
+func CheckRates(ctx context.Context, warehouse db.Warehouse, table, currency, date, start, end string) error {
+	dialect := warehouse.Dialect()
+	b := db.NewBuilder(dialect)
+	first := "null"
+	if date != "" {
+		first = "min(" + date + ")"
+	}
+	query := "select c.currency as currency, c.first_date as first_date from (select " + currency + " as currency, " + first + " as first_date" +
+		" from " + dialect.Table(table) + " where " + currency + " is not null and " + currency + " <> " + b.Arg(db.DefaultCurrency)
+	if date != "" && start != "" {
+		query += " and " + date + " >= " + b.DateArg(start)
+	}
+	if date != "" && end != "" {
+		query += " and " + date + " <= " + b.DateArg(end)
+	}
+	query += " group by " + currency + ") c left join (select from_currency, min(rate_date) as first_rate from " + dialect.Table(exchangeRates) +
+		" where to_currency = " + b.Arg(db.DefaultCurrency) + " group by from_currency) r on r.from_currency = c.currency" +
+		" where r.first_rate is null"
+	if date != "" {
+		query += " or r.first_rate > c.first_date"
+	}
+	query += " order by c.currency"
+	rows, err := warehouse.Query(ctx, query, b.Args()...)
+	if err != nil {
+		return fmt.Errorf("exchange rates: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	missing := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row["first_date"] == nil {
+			missing = append(missing, row.String("currency"))
+		} else {
+			missing = append(missing, row.String("currency")+" on "+row.Date("first_date"))
+		}
+	}
+	return fmt.Errorf("%w: %s in %s", ErrMissingRate, strings.Join(missing, ", "), table)
+}
+
+// converts reports whether a base metric's amounts go through exchange
+// rates: currency sums and averages over a table with a currency column, or
+// reported in a currency other than the default.
+func (r *Registry) converts(m *Metric, p Params) bool {
+	if m.Unit != db.UnitCurrency || m.Aggregation == "count" || m.Aggregation == "count_distinct" {
+		return false
+	}
+	return r.currencies[m.Table] != "" || p.ReportingCurrency() != db.DefaultCurrency
+}
+
+// convert scales expr from each row's currency into the default currency,
+// then into the reporting currency. Rows without a currency are taken to be
+// in the default currency; checkCurrency rejects windows with rows dated
+// before the first rate of their currency.
+func (r *Registry) convert(m *Metric, p Params, expr string) string {
+	if column := r.currencies[m.Table]; column != "" {
+		expr = toDefault("fx_from", "f."+column, expr)
+	}
+	if p.ReportingCurrency() != db.DefaultCurrency {
+		expr = "(" + expr + ") / fx_to.fx_rate"
+	}
+	return expr
+}
+
+// exchangeJoins joins the rates convert needs: into the default currency
+// from each row's currency, and from the reporting currency. Rows convert at
+// the latest rates on or before their date column; metrics without one use
+// the latest rates.
+func (r *Registry) exchangeJoins(b *db.Builder, m *Metric, p Params) string {
+	date := ""
+	if m.DateColumn != "" {
+		date = "f." + m.DateColumn
+	}
+	var joins string
+	if column := r.currencies[m.Table]; column != "" {
+		joins += rateJoin(b.Dialect(), "fx_from", "f."+column, date)
+	}
+	if target := p.ReportingCurrency(); target != db.DefaultCurrency {
+		joins += rateJoin(b.Dialect(), "fx_to", b.Arg(target), date)
+	}
+	return joins
+}
+
+// ToDefaultCurrency converts amount, in the currency named by the currency
+// column, into the default currency at the latest rate on or before date,
+// as the currency metrics do. It returns the converted expression and the
+// join it needs, whose rates are aliased alias. Reports that sum raw fact
+// amounts use it so they agree with the metrics.
+func ToDefaultCurrency(dialect db.Dialect, alias, amount, currency, date string) (string, string) {
+	return toDefault(alias, currency, amount), rateJoin(dialect, alias, currency, date)
+}
+
+func toDefault(alias, currency, amount string) string {
+	base := "'" + db.DefaultCurrency + "'"
+	return "(" + amount + ") * case when coalesce(" + currency + ", " + base + ") = " + base + " then 1 else " + alias + ".fx_rate end"
+}
+
+// rateJoin joins the rate into the default currency of currency as of date,
+// or the latest rate when date is empty. Each rate holds from its day until
+// the next rate of its currency, so days without a rate use the last one
+// before them.
+func rateJoin(dialect db.Dialect, alias, currency, date string) string {
+	spans := "select from_currency as fx_currency, rate_date as fx_date, rate as fx_rate," +
+		" lead(rate_date) over (partition by from_currency order by rate_date) as fx_until" +
+		" from " + dialect.Table(exchangeRates) + " where to_currency = '" + db.DefaultCurrency + "'"
+	on := alias + ".fx_currency = " + currency
+	if date == "" {
+		on += " and " + alias + ".fx_until is null"
+	} else {
+		on += " and " + alias + ".fx_date <= " + date + " and (" + alias + ".fx_until is null or " + alias + ".fx_until > " + date + ")"
+	}
+	return " left join (" + spans + ") " + alias + " on " + on
+}
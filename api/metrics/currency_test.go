@@ -0,0 +1,54 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+)
+
+func TestMissingRates(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+
+	// The seeded rates start 399 days ago.
+	insert := `insert into fact_orders (order_id, order_date, account_id, user_id, product_id, net_amount, currency) values (?, ?, 'acct_001', 'user_001', 'prod_001', 100, ?)`
+	for _, order := range []struct{ id, date, currency string }{
+		{"order_gbp_old", day(-420), "GBP"},
+		{"order_jpy", day(-3), "JPY"},
+		{"order_eur", day(-45), "EUR"},
+	} {
+		if _, err := warehouse.ExecContext(ctx, insert, order.id, order.date, order.currency); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		metric  string
+		p       metrics.Params
+		missing bool
+	}{
+		{name: "converted orders", metric: "revenue", p: metrics.Params{StartDate: day(-60), EndDate: day(-40)}},
+		{name: "order before its currency's first rate", metric: "revenue", p: metrics.Params{StartDate: day(-430), EndDate: day(-410)}, missing: true},
+		{name: "currency without rates", metric: "revenue", p: metrics.Params{StartDate: day(-10), EndDate: day(0)}, missing: true},
+		{name: "derived metric over unconverted orders", metric: "arpu", p: metrics.Params{StartDate: day(-10), EndDate: day(0)}, missing: true},
+		{name: "counts need no rates", metric: "paying_accounts", p: metrics.Params{StartDate: day(-10), EndDate: day(0)}},
+		{name: "reporting currency before its first rate", metric: "revenue", p: metrics.Params{StartDate: day(-405), EndDate: day(-400), Currency: "EUR"}, missing: true},
+		{name: "reporting currency with rates", metric: "revenue", p: metrics.Params{StartDate: day(-60), EndDate: day(-40), Currency: "EUR"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := registry.Evaluate(ctx, warehouse, tt.metric, tt.p)
+			if missing := errors.Is(err, metrics.ErrMissingRate); missing != tt.missing {
+				t.Errorf("err = %v, want missing rate %v", err, tt.missing)
+			}
+			if !tt.missing && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"revenue-dashboard-api/db"
+)
+
+var ErrDrillUnsupported = errors.New("only base sum metrics can be drilled into")
+
+// DrillValue is the column drill queries return each row's contribution to
+// the metric in, and the sort key for ordering rows by it. DrillSortKey
+// holds the contribution as exact text when rows are sorted by it, to be
+// passed back in After.
+const (
+	DrillValue   = "value"
+	DrillSortKey = "sort_key"
+)
+
+// Drill selects one page of the fact rows behind a base metric. Rows are
+// ordered by Sort, a fact column or DrillValue, then by the unique Key; After
+// holds the sort and key values of the last row of the previous page, the
+// DrillSortKey text when sorting by DrillValue.
+type Drill struct {
+	Columns    []string
+	Key        string
+	Sort       string
+	Descending bool
+	After      []interface{}
+	Limit      int
+}
+
+// Drill returns the rows behind a sum metric under exactly the filters,
+// joins and currency conversion Evaluate applies, each with its contribution
+// under DrillValue, so the values of every page add up to the metric.
+func (r *Registry) Drill(ctx context.Context, warehouse db.Warehouse, name string, d Drill, p Params) ([]db.Row, error) {
+	metric, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMetric, name)
+	}
+	if metric.Derived() || metric.Aggregation != "sum" {
+		return nil, fmt.Errorf("%w: %s", ErrDrillUnsupported, metric.Name)
+	}
+	if err := r.checkFilters(metric.Name, p.Filters); err != nil {
+		return nil, err
+	}
+	if err := r.checkCurrency(ctx, warehouse, metric, p); err != nil {
+		return nil, err
+	}
+	for _, column := range append([]string{d.Key}, d.Columns...) {
+		if !identifier.MatchString(column) {
+			return nil, fmt.Errorf("drill %s: invalid column %q", metric.Name, column)
+		}
+	}
+
+	// Rows the sum skips (null amounts, missing exchange rates) contribute
+	// zero.
+	value := metric.Expression
+	if r.converts(metric, p) {
+		value = r.convert(metric, p, value)
+	}
+	value = "coalesce(" + value + ", 0)"
+	dialect := warehouse.Dialect()
+	sort := "f." + d.Sort
+	if d.Sort == DrillValue {
+		sort = value
+	}
+	direction, past := " asc", " > "
+	if d.Descending {
+		direction, past = " desc", " < "
+	}
+
+	b := db.NewBuilder(dialect)
+	var columns []string
+	for _, column := range d.Columns {
+		columns = append(columns, "f."+column+" as "+column)
+	}
+	if d.Sort == DrillValue {
+		columns = append(columns, dialect.DecimalText(value)+" as "+DrillSortKey)
+	}
+	query := "select " + strings.Join(columns, ", ") + ", " + value + " as " + DrillValue +
+		r.from(b, metric, p, r.joins(metric, p, nil))
+	where := r.where(b, metric, p)
+	query += where
+	if len(d.After) == 2 {
+		arg := func(v interface{}) string {
+			switch d.Sort {
+			case metric.DateColumn:
+				if s, ok := v.(string); ok {
+					return b.DateArg(s)
+				}
+			case DrillValue:
+				return dialect.Decimal(b.Arg(v))
+			}
+			return b.Arg(v)
+		}
+		condition := "(" + sort + past + arg(d.After[0]) +
+			" or (" + sort + " = " + arg(d.After[0]) + " and f." + d.Key + past + b.Arg(d.After[1]) + "))"
+		if where == "" {
+			query += " where " + condition
+		} else {
+			query += " and " + condition
+		}
+	}
+	query += " order by " + sort + direction + ", f." + d.Key + direction + " limit " + b.Arg(d.Limit)
+
+	rows, err := warehouse.Query(ctx, query, b.Args()...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", metric.Name, err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,289 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"revenue-dashboard-api/db"
+)
+
+var (
+	ErrUnknownMetric        = errors.New("unknown metric")
+	ErrTrendUnsupported     = errors.New("metric has no trend")
+	ErrUnknownDimension     = errors.New("unknown dimension")
+	ErrDimensionUnsupported = errors.New("dimension does not apply to metric")
+)
+
+// Evaluate computes a metric for the window in p. Derived metrics evaluate
+// each dependency once and report the numerator and denominator of their
+// top-level ratio.
+func (r *Registry) Evaluate(ctx context.Context, warehouse db.Warehouse, name string, p Params) (db.MetricValue, error) {
+	metric, ok := r.Get(name)
+	if !ok {
+		return db.MetricValue{}, fmt.Errorf("%w: %s", ErrUnknownMetric, name)
+	}
+	if err := r.checkFilters(metric.Name, p.Filters); err != nil {
+		return db.MetricValue{}, err
+	}
+	if err := r.checkCurrency(ctx, warehouse, metric, p); err != nil {
+		return db.MetricValue{}, err
+	}
+
+	values := map[string]float64{}
+	value, err := r.value(ctx, warehouse, metric, p, values)
+	if err != nil {
+		return db.MetricValue{}, err
+	}
+
+	result := db.MetricValue{Value: value, Unit: metric.Unit}
+	if metric.Unit == db.UnitCurrency {
+		result.Value = round(value)
+		result.Currency = p.ReportingCurrency()
+	}
+	if metric.Derived() {
+		result.Value = round(value)
+		if numerator, denominator, ok := ratioParts(metric.formula); ok {
+			n := numerator.eval(values)
+			d := denominator.eval(values)
+			result.Numerator = &n
+			result.Denominator = &d
+		}
+	}
+	return result, nil
+}
+
+func (r *Registry) value(ctx context.Context, warehouse db.Warehouse, metric *Metric, p Params, values map[string]float64) (float64, error) {
+	if value, ok := values[metric.Name]; ok {
+		return value, nil
+	}
+
+	var value float64
+	if metric.Derived() {
+		for _, dep := range metric.deps {
+			if _, err := r.value(ctx, warehouse, r.metrics[dep], p, values); err != nil {
+				return 0, err
+			}
+		}
+		value = metric.formula.eval(values)
+	} else {
+		query, args := r.scalarSQL(warehouse.Dialect(), metric, p)
+		rows, err := warehouse.Query(ctx, query, args...)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", metric.Name, err)
+		}
+		if len(rows) > 0 {
+			value = rows[0].Float("value")
+		}
+	}
+
+	values[metric.Name] = value
+	return value, nil
+}
+
+// Trend evaluates a metric per day, week, month, quarter or year of the
+// window. Every bucket is returned in order, with zero where there is no
+// data, and derived metrics are evaluated bucket by bucket from their
+// dependencies' series. Snapshot metrics read the snapshot on the first or
+// last day of each bucket; point-in-time metrics chart the metric named by
+// their trend field.
+func (r *Registry) Trend(ctx context.Context, warehouse db.Warehouse, name, granularity string, p Params) ([]db.TrendPoint, error) {
+	metric, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMetric, name)
+	}
+	if err := r.checkFilters(metric.Name, p.Filters); err != nil {
+		return nil, err
+	}
+	if err := r.checkCurrency(ctx, warehouse, metric, p); err != nil {
+		return nil, err
+	}
+	if granularity == "" {
+		granularity = db.GranularityDay
+	}
+	windows, err := buckets(p.StartDate, p.EndDate, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaf leafFunc
+	leaf = func(ctx context.Context, m *Metric) (map[string]float64, error) {
+		switch {
+		case m.Trend != "":
+			return r.grouped(ctx, r.metrics[m.Trend], leaf)
+		case m.DateColumn == "":
+			return nil, fmt.Errorf("%w: %s", ErrTrendUnsupported, m.Name)
+		case m.Snapshot == "":
+			query, args := r.trendSQL(warehouse.Dialect(), m, granularity, p)
+			return r.queryBuckets(ctx, warehouse, m, query, args)
+		}
+
+		// Read the daily series of snapshots across the window, then pick
+		// each bucket's first or last day.
+		daily := *m
+		daily.Snapshot = ""
+		query, args := r.trendSQL(warehouse.Dialect(), &daily, db.GranularityDay, p)
+		days, err := r.queryBuckets(ctx, warehouse, m, query, args)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]float64, len(windows))
+		for _, w := range windows {
+			if m.Snapshot == "start" {
+				values[w.date] = days[w.start]
+			} else {
+				values[w.date] = days[w.end]
+			}
+		}
+		return values, nil
+	}
+
+	values, err := r.grouped(ctx, metric, leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]db.TrendPoint, 0, len(windows))
+	for _, w := range windows {
+		points = append(points, db.TrendPoint{Date: w.date, Value: round(values[w.date])})
+	}
+	return points, nil
+}
+
+// Breakdown evaluates a metric once per value of a dimension, largest first.
+func (r *Registry) Breakdown(ctx context.Context, warehouse db.Warehouse, name, dimension string, p Params) ([]db.BreakdownRow, error) {
+	metric, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMetric, name)
+	}
+	dim, ok := r.dimensions[dimension]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDimension, dimension)
+	}
+	if !r.Supports(metric.Name, dim) {
+		return nil, fmt.Errorf("%w: %s by %s", ErrDimensionUnsupported, metric.Name, dimension)
+	}
+	if err := r.checkFilters(metric.Name, p.Filters); err != nil {
+		return nil, err
+	}
+	if err := r.checkCurrency(ctx, warehouse, metric, p); err != nil {
+		return nil, err
+	}
+
+	values, err := r.grouped(ctx, metric, func(ctx context.Context, m *Metric) (map[string]float64, error) {
+		query, args := r.breakdownSQL(warehouse.Dialect(), m, dim, p)
+		return r.queryBuckets(ctx, warehouse, m, query, args)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]db.BreakdownRow, 0, len(values))
+	for value, v := range values {
+		rows = append(rows, db.BreakdownRow{DimensionValue: value, Value: round(v)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Value != rows[j].Value {
+			return rows[i].Value > rows[j].Value
+		}
+		return rows[i].DimensionValue < rows[j].DimensionValue
+	})
+	return rows, nil
+}
+
+// leafFunc evaluates one base metric per bucket.
+type leafFunc func(ctx context.Context, m *Metric) (map[string]float64, error)
+
+// grouped evaluates a metric per bucket. Base metrics are evaluated by leaf;
+// derived metrics combine their dependencies bucket by bucket, treating
+// buckets missing from a dependency as zero.
+func (r *Registry) grouped(ctx context.Context, metric *Metric, leaf leafFunc) (map[string]float64, error) {
+	leaves := map[string]map[string]float64{}
+	if err := r.collect(ctx, metric, leaf, leaves); err != nil {
+		return nil, err
+	}
+	if !metric.Derived() {
+		return leaves[metric.Name], nil
+	}
+
+	keys := map[string]bool{}
+	for _, buckets := range leaves {
+		for key := range buckets {
+			keys[key] = true
+		}
+	}
+	result := make(map[string]float64, len(keys))
+	for key := range keys {
+		values := map[string]float64{}
+		for name, buckets := range leaves {
+			values[name] = buckets[key]
+		}
+		result[key] = round(r.derive(metric, values))
+	}
+	return result, nil
+}
+
+func (r *Registry) collect(ctx context.Context, metric *Metric, leaf leafFunc, leaves map[string]map[string]float64) error {
+	if _, ok := leaves[metric.Name]; ok {
+		return nil
+	}
+
+	if metric.Derived() && metric.Trend == "" {
+		for _, dep := range metric.deps {
+			if err := r.collect(ctx, r.metrics[dep], leaf, leaves); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	buckets, err := leaf(ctx, metric)
+	if err != nil {
+		return err
+	}
+	leaves[metric.Name] = buckets
+	return nil
+}
+
+// queryBuckets runs a grouped query whose rows carry a "bucket" key and a
+// "value".
+func (r *Registry) queryBuckets(ctx context.Context, warehouse db.Warehouse, m *Metric, query string, args []interface{}) (map[string]float64, error) {
+	rows, err := warehouse.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Name, err)
+	}
+	buckets := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		buckets[bucketKey(row)] = row.Float("value")
+	}
+	return buckets, nil
+}
+
+// bucketKey reads the grouping column, normalizing dates to YYYY-MM-DD.
+func bucketKey(row db.Row) string {
+	if _, ok := row["bucket"].(time.Time); ok {
+		return row.Date("bucket")
+	}
+	return row.String("bucket")
+}
+
+// derive evaluates a derived metric from base values, filling in any
+// intermediate derived metrics it depends on.
+func (r *Registry) derive(metric *Metric, values map[string]float64) float64 {
+	if value, ok := values[metric.Name]; ok || !metric.Derived() {
+		return value
+	}
+	for _, dep := range metric.deps {
+		r.derive(r.metrics[dep], values)
+	}
+	value := metric.formula.eval(values)
+	values[metric.Name] = value
+	return value
+}
+
+func round(value float64) float64 {
+	return math.Round(value*1e4) / 1e4
+}
@@ -0,0 +1,255 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+)
+
+// day is the date offset days from today, the day the fixture's facts are
+// seeded back from.
+func day(offset int) string {
+	return time.Now().UTC().AddDate(0, 0, offset).Format("2006-01-02")
+}
+
+// The fixture's last ten days hold orders of 1000 + 25i on day -i, 40
+// sessions and 20 active users a day, and 300 + 5i of spend on day -i.
+func TestEvaluate(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+	p := metrics.Params{StartDate: day(-9), EndDate: day(0)}
+
+	tests := []struct {
+		metric string
+		want   float64
+	}{
+		{metric: "revenue", want: 11125},
+		{metric: "gross_revenue", want: 12315},
+		{metric: "discounts", want: 200},
+		{metric: "refunds", want: 100},
+		{metric: "tax", want: 890},
+		{metric: "refund_rate", want: 0.812},
+		{metric: "discount_rate", want: 1.624},
+		{metric: "sessions", want: 400},
+		{metric: "conversions", want: 40},
+		{metric: "conversion_rate", want: 10},
+		{metric: "active_users", want: 20},
+		{metric: "arpu", want: 556.25},
+		{metric: "mrr", want: 3500},
+		{metric: "mrr_start", want: 2710},
+		{metric: "mrr_end", want: 2800},
+		{metric: "nrr", want: 103.321},
+		{metric: "customers_start", want: 113},
+		{metric: "customers_end", want: 110},
+		{metric: "churn_rate", want: 2.6549},
+		{metric: "ltv", want: 20952.0833},
+		{metric: "marketing_spend", want: 3225},
+		{metric: "paying_accounts", want: 1},
+		{metric: "cac", want: 3225},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			value, err := registry.Evaluate(ctx, warehouse, tt.metric, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(value.Value-tt.want) > 1e-9 {
+				t.Errorf("value = %v, want %v", value.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateRatioParts(t *testing.T) {
+	value, err := metrics.NewRegistry().Evaluate(context.Background(), sqlitetest.Open(t), "arpu", metrics.Params{StartDate: day(-9), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Numerator == nil || *value.Numerator != 11125 || value.Denominator == nil || *value.Denominator != 20 {
+		t.Errorf("numerator %v, denominator %v, want 11125 and 20", value.Numerator, value.Denominator)
+	}
+}
+
+// Orders -i of the last ten days belong to user i%20, whose country is
+// US, CA, GB, DE in turn; their products are platform, add_on, services in
+// turn.
+func TestEvaluateFilters(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+
+	tests := []struct {
+		metric  string
+		filters string
+		want    float64
+	}{
+		{metric: "revenue", filters: "country_code:eq:US", want: 3300},
+		{metric: "revenue", filters: "country_code:in:US|CA", want: 6675},
+		{metric: "revenue", filters: "country_code:ne:US", want: 7825},
+		{metric: "revenue", filters: "country_code:not_in:US|CA|GB|DE", want: 0},
+		{metric: "revenue", filters: "product_category:eq:platform", want: 4450},
+		{metric: "revenue", filters: "product_category:eq:platform,country_code:eq:US", want: 1000},
+		{metric: "revenue", filters: "plan_type:eq:enterprise", want: 11125},
+		{metric: "revenue", filters: "account_id:eq:acct_002", want: 0},
+		{metric: "sessions", filters: "channel:eq:Email", want: 100},
+		{metric: "arpu", filters: "country_code:eq:US", want: 660},
+		{metric: "mrr", filters: "plan_type:eq:growth", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric+" "+tt.filters, func(t *testing.T) {
+			filters, err := metrics.ParseFilters(tt.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := registry.Evaluate(ctx, warehouse, tt.metric, metrics.Params{StartDate: day(-9), EndDate: day(0), Filters: filters})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(value.Value-tt.want) > 1e-9 {
+				t.Errorf("value = %v, want %v", value.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakdown(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+	p := metrics.Params{StartDate: day(-9), EndDate: day(0)}
+
+	tests := []struct {
+		metric    string
+		dimension string
+		want      []string
+		values    []float64
+	}{
+		{metric: "revenue", dimension: "country_code", want: []string{"CA", "US", "DE", "GB"}, values: []float64{3375, 3300, 2250, 2200}},
+		{metric: "revenue", dimension: "product_category", want: []string{"platform", "services", "add_on"}, values: []float64{4450, 3375, 3300}},
+		{metric: "revenue", dimension: "plan_type", want: []string{"enterprise"}, values: []float64{11125}},
+		{metric: "arpu", dimension: "country_code", want: []string{"CA", "US", "DE", "GB"}, values: []float64{675, 660, 450, 440}},
+		{metric: "marketing_spend", dimension: "channel", want: []string{"Paid Search", "Email"}, values: []float64{2225, 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric+" by "+tt.dimension, func(t *testing.T) {
+			rows, err := registry.Breakdown(ctx, warehouse, tt.metric, tt.dimension, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("rows = %v, want %v", rows, tt.want)
+			}
+			for i, row := range rows {
+				if row.DimensionValue != tt.want[i] || math.Abs(row.Value-tt.values[i]) > 1e-9 {
+					t.Errorf("row %d = %s %v, want %s %v", i, row.DimensionValue, row.Value, tt.want[i], tt.values[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+	p := metrics.Params{StartDate: day(-9), EndDate: day(0)}
+
+	tests := []struct {
+		name      string
+		metric    string
+		dimension string
+		filters   []metrics.Filter
+		want      error
+	}{
+		{name: "unknown metric", metric: "profit", want: metrics.ErrUnknownMetric},
+		{name: "unknown filter column", metric: "revenue", filters: []metrics.Filter{{Column: "color", Op: "eq", Value: "red"}}, want: metrics.ErrInvalidFilter},
+		{name: "filter the metric cannot reach", metric: "revenue", filters: []metrics.Filter{{Column: "channel", Op: "eq", Value: "Email"}}, want: metrics.ErrFilterUnsupported},
+		{name: "key the metric lacks", metric: "mrr", filters: []metrics.Filter{{Column: "user_id", Op: "eq", Value: "user_01"}}, want: metrics.ErrFilterUnsupported},
+		{name: "filter a dependency cannot reach", metric: "cac", filters: []metrics.Filter{{Column: "product_category", Op: "eq", Value: "platform"}}, want: metrics.ErrFilterUnsupported},
+		{name: "unknown dimension", metric: "revenue", dimension: "color", want: metrics.ErrUnknownDimension},
+		{name: "dimension the metric cannot reach", metric: "revenue", dimension: "channel", want: metrics.ErrDimensionUnsupported},
+		{name: "dimension a dependency cannot reach", metric: "arpu", dimension: "product_category", want: metrics.ErrDimensionUnsupported},
+		{name: "breakdown of an unknown metric", metric: "profit", dimension: "plan_type", want: metrics.ErrUnknownMetric},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := p
+			p.Filters = tt.filters
+			var err error
+			if tt.dimension != "" {
+				_, err = registry.Breakdown(ctx, warehouse, tt.metric, tt.dimension, p)
+			} else {
+				_, err = registry.Evaluate(ctx, warehouse, tt.metric, p)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrendByWeek(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+	p := metrics.Params{StartDate: day(-29), EndDate: day(0)}
+
+	// Each order's ISO week starts on the Monday on or before it.
+	want := map[string]float64{}
+	today := time.Now().UTC()
+	for i := 0; i < 30; i++ {
+		date := today.AddDate(0, 0, -i)
+		monday := date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+		want[monday.Format("2006-01-02")] += float64(1000 + i*25)
+	}
+
+	points, err := registry.Trend(ctx, warehouse, "revenue", "week", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != len(want) {
+		t.Fatalf("%d points, want %d", len(points), len(want))
+	}
+	var sum float64
+	for i, point := range points {
+		date, err := time.Parse("2006-01-02", point.Date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if date.Weekday() != time.Monday {
+			t.Errorf("point %s is a %s", point.Date, date.Weekday())
+		}
+		if i > 0 && point.Date <= points[i-1].Date {
+			t.Errorf("point %s follows %s", point.Date, points[i-1].Date)
+		}
+		if point.Value != want[point.Date] {
+			t.Errorf("week of %s = %v, want %v", point.Date, point.Value, want[point.Date])
+		}
+		sum += point.Value
+	}
+	if sum != 40875 {
+		t.Errorf("weeks add up to %v, want 40875", sum)
+	}
+}
+
+func TestTrendDerived(t *testing.T) {
+	points, err := metrics.NewRegistry().Trend(context.Background(), sqlitetest.Open(t), "conversion_rate", "day", metrics.Params{StartDate: day(-2), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{day(-2), day(-1), day(0)}
+	if len(points) != len(want) {
+		t.Fatalf("points = %v, want %v", points, want)
+	}
+	for i, point := range points {
+		if point.Date != want[i] || point.Value != 10 {
+			t.Errorf("point %d = %s %v, want %s 10", i, point.Date, point.Value, want[i])
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"revenue-dashboard-api/db"
+)
+
+var (
+	ErrInvalidFilter     = errors.New("invalid filter")
+	ErrFilterUnsupported = errors.New("filter does not apply to metric")
+)
+
+var comparisons = map[string]string{
+	"eq":     "=",
+	"ne":     "<>",
+	"gt":     ">",
+	"gte":    ">=",
+	"lt":     "<",
+	"lte":    "<=",
+	"in":     "in",
+	"not_in": "not in",
+}
+
+// ParseFilters reads the filter query parameter: comma-separated
+// column:op:value terms such as "plan_type:eq:enterprise", where in and
+// not_in take "|"-separated values ("country_code:in:US|CA"). Columns are
+// checked against the registry when the filters are applied to a metric.
+func ParseFilters(raw string) ([]Filter, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var filters []Filter
+	for _, term := range strings.Split(raw, ",") {
+		parts := strings.SplitN(term, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%w: %q is not column:op:value", ErrInvalidFilter, term)
+		}
+		column, op, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), parts[2]
+		if !identifier.MatchString(column) {
+			return nil, fmt.Errorf("%w: invalid column %q", ErrInvalidFilter, column)
+		}
+		if _, ok := comparisons[op]; !ok {
+			return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidFilter, op)
+		}
+		filter := Filter{Column: column, Op: op, Value: value}
+		if op == "in" || op == "not_in" {
+			filter.Value = strings.Split(value, "|")
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// checkFilters rejects request filters on columns that are neither a
+// dimension nor a join key, or that some source table of the metric cannot
+// reach.
+func (r *Registry) checkFilters(name string, filters []Filter) error {
+	for _, f := range filters {
+		dim, isDimension := r.dimensions[f.Column]
+		if !isDimension && !r.isKey(f.Column) {
+			return fmt.Errorf("%w: unknown column %s", ErrInvalidFilter, f.Column)
+		}
+		if isDimension && !r.Supports(name, dim) || !isDimension && !r.HasKey(name, f.Column) {
+			return fmt.Errorf("%w: %s on %s", ErrFilterUnsupported, name, f.Column)
+		}
+	}
+	return nil
+}
+
+func (r *Registry) isKey(column string) bool {
+	for _, keys := range r.tableKeys {
+		if keys[column] {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSQL compiles one filter into a condition, binding every value.
+// Filters on dimensions compare against the joined dimension value; anything
+// else is a column of the fact table.
+func (r *Registry) filterSQL(b *db.Builder, f Filter) string {
+	column := "f." + f.Column
+	if dim, ok := r.dimensions[f.Column]; ok {
+		column = dimensionColumn(dim)
+	}
+	return Condition(b, column, f)
+}
+
+// Condition compiles a filter into a condition on column, for reports that
+// apply request filters to tables of their own.
+func Condition(b *db.Builder, column string, f Filter) string {
+	if f.Op != "in" && f.Op != "not_in" {
+		return column + " " + comparisons[f.Op] + " " + b.Arg(f.Value)
+	}
+	var placeholders []string
+	for _, value := range filterValues(f.Value) {
+		placeholders = append(placeholders, b.Arg(value))
+	}
+	return column + " " + comparisons[f.Op] + " (" + strings.Join(placeholders, ", ") + ")"
+}
+
+// filterValues flattens the value of an in filter, whether it came from the
+// query string or from a YAML list.
+func filterValues(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
@@ -0,0 +1,281 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expr is a parsed derived-metric formula.
+type expr interface {
+	eval(values map[string]float64) float64
+}
+
+type numberExpr float64
+
+type refExpr string
+
+type unaryExpr struct {
+	operand expr
+}
+
+type binaryExpr struct {
+	op          byte
+	left, right expr
+}
+
+type callExpr struct {
+	name string
+	args []expr
+}
+
+func (n numberExpr) eval(map[string]float64) float64 {
+	return float64(n)
+}
+
+func (r refExpr) eval(values map[string]float64) float64 {
+	return values[string(r)]
+}
+
+func (u unaryExpr) eval(values map[string]float64) float64 {
+	return -u.operand.eval(values)
+}
+
+func (b binaryExpr) eval(values map[string]float64) float64 {
+	left := b.left.eval(values)
+	right := b.right.eval(values)
+	switch b.op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	default:
+		if right == 0 {
+			return 0
+		}
+		return left / right
+	}
+}
+
+func (c callExpr) eval(values map[string]float64) float64 {
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.eval(values)
+	}
+	switch c.name {
+	case "abs":
+		return math.Abs(args[0])
+	case "min":
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Min(result, v)
+		}
+		return result
+	default:
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Max(result, v)
+		}
+		return result
+	}
+}
+
+// refs lists the metric names a formula depends on.
+func refs(e expr) []string {
+	switch v := e.(type) {
+	case refExpr:
+		return []string{string(v)}
+	case unaryExpr:
+		return refs(v.operand)
+	case binaryExpr:
+		return append(refs(v.left), refs(v.right)...)
+	case callExpr:
+		var names []string
+		for _, arg := range v.args {
+			names = append(names, refs(arg)...)
+		}
+		return names
+	default:
+		return nil
+	}
+}
+
+// ratioParts finds the division that defines a ratio metric, looking through
+// scaling by constants, so "a / b * 100" reports a and b.
+func ratioParts(e expr) (expr, expr, bool) {
+	b, ok := e.(binaryExpr)
+	if !ok {
+		return nil, nil, false
+	}
+	switch b.op {
+	case '/':
+		return b.left, b.right, true
+	case '*':
+		if _, ok := b.right.(numberExpr); ok {
+			return ratioParts(b.left)
+		}
+		if _, ok := b.left.(numberExpr); ok {
+			return ratioParts(b.right)
+		}
+	}
+	return nil, nil, false
+}
+
+var functionArity = map[string]int{"abs": 1, "min": -1, "max": -1}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func parseFormula(src string) (expr, error) {
+	p := &parser{src: src}
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos:], p.pos)
+	}
+	return e, nil
+}
+
+func (p *parser) parseSum() (expr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseProduct() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at offset %d", p.pos)
+		}
+		p.pos++
+		return e, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, err
+		}
+		return numberExpr(value), nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if p.peek() != '(' {
+			return refExpr(name), nil
+		}
+		return p.parseCall(strings.ToLower(name))
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of formula")
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, p.pos)
+	}
+}
+
+func (p *parser) parseCall(name string) (expr, error) {
+	arity, ok := functionArity[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	p.pos++
+	var args []expr
+	for {
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) after %s arguments", name)
+		}
+		p.pos++
+		break
+	}
+	if (arity > 0 && len(args) != arity) || len(args) == 0 {
+		return nil, fmt.Errorf("wrong number of arguments to %s", name)
+	}
+	return callExpr{name: name, args: args}, nil
+}
+
+// peek skips whitespace and returns the next byte, or 0 at the end.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
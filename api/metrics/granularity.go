@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"revenue-dashboard-api/db"
+)
+
+var (
+	ErrUnknownGranularity = errors.New("unknown granularity")
+	ErrInvalidDateRange   = errors.New("invalid date range")
+)
+
+var granularities = map[string]bool{
+	db.GranularityDay:     true,
+	db.GranularityWeek:    true,
+	db.GranularityMonth:   true,
+	db.GranularityQuarter: true,
+	db.GranularityYear:    true,
+}
+
+// maxTrendBuckets bounds gap filling so a daily trend over decades cannot
+// produce an unbounded response.
+const maxTrendBuckets = 3660
+
+// bucket is one point of a trend: the date labelling it (the first day of
+// the granularity period) and the days of the request window it covers.
+type bucket struct {
+	date       string
+	start, end string
+}
+
+// ParseDateRange checks that both dates are YYYY-MM-DD and the range is not
+// reversed.
+func ParseDateRange(startDate, endDate string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: start_date must be YYYY-MM-DD", ErrInvalidDateRange)
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: end_date must be YYYY-MM-DD", ErrInvalidDateRange)
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: end_date is before start_date", ErrInvalidDateRange)
+	}
+	return start, end, nil
+}
+
+// buckets lists every bucket overlapping the window, matching the bucketing
+// of Dialect.DateTrunc. The first and last buckets are clipped to the window.
+func buckets(startDate, endDate, granularity string) ([]bucket, error) {
+	if !granularities[granularity] {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownGranularity, granularity)
+	}
+	start, end, err := ParseDateRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []bucket
+	for t := truncate(start, granularity); !t.After(end); t = nextBucket(t, granularity) {
+		if len(result) == maxTrendBuckets {
+			return nil, fmt.Errorf("%w: more than %d %s buckets, use a coarser granularity", ErrInvalidDateRange, maxTrendBuckets, granularity)
+		}
+		first, last := t, nextBucket(t, granularity).AddDate(0, 0, -1)
+		if first.Before(start) {
+			first = start
+		}
+		if last.After(end) {
+			last = end
+		}
+		result = append(result, bucket{date: db.FormatDate(t), start: db.FormatDate(first), end: db.FormatDate(last)})
+	}
+	return result, nil
+}
+
+func truncate(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case db.GranularityWeek:
+		return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	case db.GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case db.GranularityQuarter:
+		return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case db.GranularityYear:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t
+	}
+}
+
+func nextBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case db.GranularityWeek:
+		return t.AddDate(0, 0, 7)
+	case db.GranularityMonth:
+		return t.AddDate(0, 1, 0)
+	case db.GranularityQuarter:
+		return t.AddDate(0, 3, 0)
+	case db.GranularityYear:
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// BucketDates lists the date labelling every bucket overlapping the window,
+// for reports that gap-fill their own grouped queries.
+func BucketDates(startDate, endDate, granularity string) ([]string, error) {
+	windows, err := buckets(startDate, endDate, granularity)
+	if err != nil {
+		return nil, err
+	}
+	dates := make([]string, len(windows))
+	for i, w := range windows {
+		dates[i] = w.date
+	}
+	return dates, nil
+}
+
+// Window is one bucket overlapping a range: labelled Date, the first day of
+// the bucket, and covering StartDate to EndDate, clipped to the range.
+type Window struct {
+	Date      string
+	StartDate string
+	EndDate   string
+}
+
+// BucketWindows lists every bucket overlapping the window with the days it
+// covers, for reports evaluated bucket by bucket.
+func BucketWindows(startDate, endDate, granularity string) ([]Window, error) {
+	windows, err := buckets(startDate, endDate, granularity)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Window, len(windows))
+	for i, w := range windows {
+		result[i] = Window{Date: w.date, StartDate: w.start, EndDate: w.end}
+	}
+	return result, nil
+}
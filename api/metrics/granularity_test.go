@@ -0,0 +1,62 @@
+package metrics_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"revenue-dashboard-api/metrics"
+)
+
+func TestBucketDates(t *testing.T) {
+	tests := []struct {
+		name        string
+		start, end  string
+		granularity string
+		want        []string
+		err         error
+	}{
+		{name: "days", start: "2026-02-27", end: "2026-03-02", granularity: "day", want: []string{"2026-02-27", "2026-02-28", "2026-03-01", "2026-03-02"}},
+		{name: "ISO weeks across a year", start: "2026-12-30", end: "2027-01-12", granularity: "week", want: []string{"2026-12-28", "2027-01-04", "2027-01-11"}},
+		{name: "week starting on a Monday", start: "2026-10-12", end: "2026-10-18", granularity: "week", want: []string{"2026-10-12"}},
+		{name: "week ending on a Sunday", start: "2026-10-11", end: "2026-10-12", granularity: "week", want: []string{"2026-10-05", "2026-10-12"}},
+		{name: "months", start: "2026-01-31", end: "2026-03-01", granularity: "month", want: []string{"2026-01-01", "2026-02-01", "2026-03-01"}},
+		{name: "quarters", start: "2026-02-10", end: "2026-07-01", granularity: "quarter", want: []string{"2026-01-01", "2026-04-01", "2026-07-01"}},
+		{name: "years", start: "2025-12-31", end: "2026-01-01", granularity: "year", want: []string{"2025-01-01", "2026-01-01"}},
+		{name: "unknown granularity", start: "2026-01-01", end: "2026-01-31", granularity: "fortnight", err: metrics.ErrUnknownGranularity},
+		{name: "reversed range", start: "2026-02-01", end: "2026-01-01", granularity: "day", err: metrics.ErrInvalidDateRange},
+		{name: "unparsable date", start: "2026-02-30", end: "2026-03-01", granularity: "day", err: metrics.ErrInvalidDateRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := metrics.BucketDates(tt.start, tt.end, tt.granularity)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buckets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucketWindows(t *testing.T) {
+	got, err := metrics.BucketWindows("2026-12-30", "2027-01-12", "week")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []metrics.Window{
+		{Date: "2026-12-28", StartDate: "2026-12-30", EndDate: "2027-01-03"},
+		{Date: "2027-01-04", StartDate: "2027-01-04", EndDate: "2027-01-10"},
+		{Date: "2027-01-11", StartDate: "2027-01-11", EndDate: "2027-01-12"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("windows = %v, want %v", got, want)
+	}
+}
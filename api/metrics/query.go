@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"strings"
+
+	"revenue-dashboard-api/db"
+)
+
+// Params scopes a metric evaluation to a date range, optionally one account,
+// and any request filters. Currency is the reporting currency; empty means
+// the default currency.
+type Params struct {
+	StartDate string
+	EndDate   string
+	AccountID string
+	Filters   []Filter
+	Currency  string
+}
+
+// scalarSQL compiles a base metric into a single-row query returning "value".
+func (r *Registry) scalarSQL(dialect db.Dialect, m *Metric, p Params) (string, []interface{}) {
+	b := db.NewBuilder(dialect)
+	query := "select " + r.aggregate(m, p) + " as value" + r.from(b, m, p, r.joins(m, p, nil)) + r.where(b, m, p)
+	return query, b.Args()
+}
+
+// trendSQL compiles a base metric into a query returning one "value" per
+// "bucket" date, the start of each granularity bucket.
+func (r *Registry) trendSQL(dialect db.Dialect, m *Metric, granularity string, p Params) (string, []interface{}) {
+	b := db.NewBuilder(dialect)
+	bucket := dialect.DateTrunc(m.DateColumn, granularity)
+	query := "select " + bucket + " as bucket, " + r.aggregate(m, p) + " as value" + r.from(b, m, p, r.joins(m, p, nil)) + r.where(b, m, p) +
+		" group by " + bucket + " order by " + bucket
+	return query, b.Args()
+}
+
+// breakdownSQL compiles a base metric into a query returning one "value" per
+// "bucket" value of dim. Facts without a matching dimension row are grouped
+// under "unknown".
+func (r *Registry) breakdownSQL(dialect db.Dialect, m *Metric, dim *Dimension, p Params) (string, []interface{}) {
+	b := db.NewBuilder(dialect)
+	bucket := "coalesce(" + dimensionColumn(dim) + ", 'unknown')"
+	query := "select " + bucket + " as bucket, " + r.aggregate(m, p) + " as value" + r.from(b, m, p, r.joins(m, p, dim)) + r.where(b, m, p) +
+		" group by " + bucket
+	return query, b.Args()
+}
+
+// joins lists the dimensions a query needs, once each: the group_by
+// dimension, if any, followed by those referenced by filters.
+func (r *Registry) joins(m *Metric, p Params, groupBy *Dimension) []*Dimension {
+	var dims []*Dimension
+	seen := map[string]bool{}
+	if groupBy != nil {
+		dims = append(dims, groupBy)
+		seen[groupBy.Name] = true
+	}
+	for _, f := range append(append([]Filter(nil), m.Filters...), p.Filters...) {
+		if dim, ok := r.dimensions[f.Column]; ok && !seen[dim.Name] {
+			dims = append(dims, dim)
+			seen[dim.Name] = true
+		}
+	}
+	return dims
+}
+
+// from joins each dimension as a two-column subquery (dim_key, dim_value) so
+// the unqualified fact columns used in expressions and filters stay
+// unambiguous, followed by any exchange rates the metric needs.
+func (r *Registry) from(b *db.Builder, m *Metric, p Params, dims []*Dimension) string {
+	dialect := b.Dialect()
+	clause := " from " + dialect.Table(m.Table) + " f"
+	for _, dim := range dims {
+		alias := "d_" + dim.Name
+		clause += " left join (select " + dim.Key + " as dim_key, " + dim.Column + " as dim_value from " + dialect.Table(dim.Table) + ") " + alias +
+			" on " + alias + ".dim_key = f." + dim.Key
+	}
+	if r.converts(m, p) {
+		clause += r.exchangeJoins(b, m, p)
+	}
+	return clause
+}
+
+func dimensionColumn(dim *Dimension) string {
+	return "d_" + dim.Name + ".dim_value"
+}
+
+func (r *Registry) aggregate(m *Metric, p Params) string {
+	expression := m.Expression
+	if r.converts(m, p) {
+		expression = r.convert(m, p, expression)
+	}
+	switch m.Aggregation {
+	case "count":
+		if m.Expression == "" {
+			return "count(*)"
+		}
+		return "count(" + m.Expression + ")"
+	case "count_distinct":
+		return "count(distinct " + m.Expression + ")"
+	default:
+		return "coalesce(" + m.Aggregation + "(" + expression + "), 0)"
+	}
+}
+
+func (r *Registry) where(b *db.Builder, m *Metric, p Params) string {
+	var conditions []string
+	if m.DateColumn != "" {
+		switch m.Snapshot {
+		case "start":
+			conditions = append(conditions, m.DateColumn+" = "+b.DateArg(p.StartDate))
+		case "end":
+			conditions = append(conditions, m.DateColumn+" = "+b.DateArg(p.EndDate))
+		default:
+			conditions = append(conditions, m.DateColumn+" between "+b.DateArg(p.StartDate)+" and "+b.DateArg(p.EndDate))
+		}
+	}
+	if p.AccountID != "" {
+		conditions = append(conditions, "account_id = "+b.Arg(p.AccountID))
+	}
+	for _, f := range m.Filters {
+		conditions = append(conditions, r.filterSQL(b, f))
+	}
+	for _, f := range p.Filters {
+		conditions = append(conditions, r.filterSQL(b, f))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(conditions, " and ")
+}
@@ -0,0 +1,402 @@
+package metrics
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"revenue-dashboard-api/db"
+)
+
+//go:embed metrics.yml
+var defaultDefinitions []byte
+
+const defaultCacheTTL = 5 * time.Minute
+
+// DefaultFamily is the family of metrics that do not declare one.
+const DefaultFamily = "general"
+
+var identifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+type Filter struct {
+	Column string      `yaml:"column"`
+	Op     string      `yaml:"op"`
+	Value  interface{} `yaml:"value"`
+}
+
+type Definition struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Table       string   `yaml:"table"`
+	Aggregation string   `yaml:"aggregation"`
+	Expression  string   `yaml:"expression"`
+	DateColumn  string   `yaml:"date_column"`
+	Snapshot    string   `yaml:"snapshot"`
+	Filters     []Filter `yaml:"filters"`
+	Formula     string   `yaml:"formula"`
+	Trend       string   `yaml:"trend"`
+	Unit        string   `yaml:"unit"`
+	Family      string   `yaml:"family"`
+	CacheTTL    string   `yaml:"cache_ttl"`
+}
+
+// Dimension is an attribute of a dimension table joined to facts on Key.
+type Dimension struct {
+	Name   string `yaml:"name"`
+	Table  string `yaml:"table"`
+	Column string `yaml:"column"`
+	Key    string `yaml:"key"`
+}
+
+// Table lists the join keys of a fact table. Currency names the column
+// holding each row's transaction currency; amounts in tables without one are
+// in the default currency.
+type Table struct {
+	Name     string   `yaml:"name"`
+	Keys     []string `yaml:"keys"`
+	Currency string   `yaml:"currency"`
+}
+
+// Funnel is an ordered list of session event steps. A session reaches a
+// step when it has every earlier step in order, all within Window of the
+// first step.
+type Funnel struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description"`
+	Steps       []string      `yaml:"steps"`
+	Window      time.Duration `yaml:"-"`
+	RawWindow   string        `yaml:"window"`
+}
+
+type file struct {
+	Dimensions []Dimension  `yaml:"dimensions"`
+	Tables     []Table      `yaml:"tables"`
+	Metrics    []Definition `yaml:"metrics"`
+	Funnels    []Funnel     `yaml:"funnels"`
+}
+
+// Metric is a validated definition ready to be compiled into SQL.
+type Metric struct {
+	Definition
+	TTL     time.Duration
+	formula expr
+	deps    []string
+}
+
+func (m *Metric) Derived() bool {
+	return m.formula != nil
+}
+
+type Registry struct {
+	metrics    map[string]*Metric
+	order      []string
+	dimensions map[string]*Dimension
+	tableKeys  map[string]map[string]bool
+	currencies map[string]string
+	funnels    map[string]*Funnel
+}
+
+// Load reads metric definitions from path, or from the definitions bundled
+// with the binary when path is empty.
+func Load(path string) (*Registry, error) {
+	raw := defaultDefinitions
+	if path != "" {
+		var err error
+		raw, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Parse(raw)
+}
+
+func NewRegistry() *Registry {
+	registry, err := Load(os.Getenv("METRICS_FILE"))
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+func Parse(raw []byte) (*Registry, error) {
+	var f file
+	if err := yaml.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+
+	r := &Registry{
+		metrics:    map[string]*Metric{},
+		dimensions: map[string]*Dimension{},
+		tableKeys:  map[string]map[string]bool{},
+		currencies: map[string]string{},
+		funnels:    map[string]*Funnel{},
+	}
+	for i := range f.Dimensions {
+		dim := &f.Dimensions[i]
+		for _, ident := range []string{dim.Name, dim.Table, dim.Column, dim.Key} {
+			if !identifier.MatchString(ident) {
+				return nil, fmt.Errorf("metrics: dimension %s: invalid identifier %q", dim.Name, ident)
+			}
+		}
+		if _, exists := r.dimensions[dim.Name]; exists {
+			return nil, fmt.Errorf("metrics: dimension %s defined twice", dim.Name)
+		}
+		r.dimensions[dim.Name] = dim
+	}
+	for _, table := range f.Tables {
+		keys := map[string]bool{}
+		for _, key := range table.Keys {
+			if !identifier.MatchString(key) {
+				return nil, fmt.Errorf("metrics: table %s: invalid key %q", table.Name, key)
+			}
+			keys[key] = true
+		}
+		r.tableKeys[table.Name] = keys
+		if table.Currency != "" {
+			if !identifier.MatchString(table.Currency) {
+				return nil, fmt.Errorf("metrics: table %s: invalid currency column %q", table.Name, table.Currency)
+			}
+			r.currencies[table.Name] = table.Currency
+		}
+	}
+
+	for _, def := range f.Metrics {
+		metric, err := compileDefinition(def)
+		if err != nil {
+			return nil, fmt.Errorf("metrics: %s: %w", def.Name, err)
+		}
+		if _, exists := r.metrics[metric.Name]; exists {
+			return nil, fmt.Errorf("metrics: %s defined twice", metric.Name)
+		}
+		r.metrics[metric.Name] = metric
+		r.order = append(r.order, metric.Name)
+	}
+
+	for _, name := range r.order {
+		for _, dep := range r.metrics[name].deps {
+			if _, ok := r.metrics[dep]; !ok {
+				return nil, fmt.Errorf("metrics: %s: formula references unknown metric %s", name, dep)
+			}
+		}
+	}
+	for _, name := range r.order {
+		trend := r.metrics[name].Trend
+		if trend == "" {
+			continue
+		}
+		if target, ok := r.metrics[trend]; !ok || target.Trend != "" {
+			return nil, fmt.Errorf("metrics: %s: trend must name a metric without its own trend", name)
+		}
+	}
+	for _, name := range r.order {
+		if err := r.checkCycle(name, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range f.Funnels {
+		funnel := &f.Funnels[i]
+		if err := compileFunnel(funnel); err != nil {
+			return nil, fmt.Errorf("metrics: funnel %s: %w", funnel.Name, err)
+		}
+		if _, exists := r.funnels[funnel.Name]; exists {
+			return nil, fmt.Errorf("metrics: funnel %s defined twice", funnel.Name)
+		}
+		r.funnels[funnel.Name] = funnel
+	}
+
+	return r, nil
+}
+
+func (r *Registry) Get(name string) (*Metric, bool) {
+	metric, ok := r.metrics[Normalize(name)]
+	return metric, ok
+}
+
+func (r *Registry) Names() []string {
+	names := append([]string(nil), r.order...)
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) Dimension(name string) (*Dimension, bool) {
+	dim, ok := r.dimensions[name]
+	return dim, ok
+}
+
+func (r *Registry) DimensionNames() []string {
+	names := make([]string, 0, len(r.dimensions))
+	for name := range r.dimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) Funnel(name string) (*Funnel, bool) {
+	funnel, ok := r.funnels[Normalize(name)]
+	return funnel, ok
+}
+
+// Supports reports whether every source table behind a metric carries the
+// key needed to join dim.
+func (r *Registry) Supports(name string, dim *Dimension) bool {
+	return r.HasKey(name, dim.Key)
+}
+
+// HasKey reports whether every source table behind a metric carries key.
+func (r *Registry) HasKey(name, key string) bool {
+	metric := r.metrics[name]
+	if !metric.Derived() {
+		return r.tableKeys[metric.Table][key]
+	}
+	for _, dep := range metric.deps {
+		if !r.HasKey(dep, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// Normalize maps route spellings such as "churn-rate" to metric names.
+func Normalize(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "-", "_")
+}
+
+// PointInTime reports whether a metric ignores the request date range, as
+// current MRR does.
+func (r *Registry) PointInTime(name string) bool {
+	metric := r.metrics[name]
+	if !metric.Derived() {
+		return metric.DateColumn == ""
+	}
+	for _, dep := range metric.deps {
+		if !r.PointInTime(dep) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Registry) checkCycle(name string, visiting map[string]bool) error {
+	if visiting[name] {
+		return fmt.Errorf("metrics: %s: formula cycle", name)
+	}
+	visiting[name] = true
+	for _, dep := range r.metrics[name].deps {
+		if err := r.checkCycle(dep, visiting); err != nil {
+			return err
+		}
+	}
+	delete(visiting, name)
+	return nil
+}
+
+const defaultFunnelWindow = 24 * time.Hour
+
+func compileFunnel(funnel *Funnel) error {
+	if !identifier.MatchString(funnel.Name) {
+		return fmt.Errorf("invalid funnel name")
+	}
+	if len(funnel.Steps) < 2 {
+		return fmt.Errorf("a funnel needs at least two steps")
+	}
+	for _, step := range funnel.Steps {
+		if step == "" {
+			return fmt.Errorf("empty step")
+		}
+	}
+	funnel.Window = defaultFunnelWindow
+	if funnel.RawWindow != "" {
+		window, err := time.ParseDuration(funnel.RawWindow)
+		if err != nil || window <= 0 {
+			return fmt.Errorf("invalid window %q", funnel.RawWindow)
+		}
+		funnel.Window = window
+	}
+	return nil
+}
+
+var aggregations = map[string]bool{"sum": true, "count": true, "count_distinct": true, "avg": true, "min": true, "max": true}
+
+var units = map[string]bool{db.UnitCurrency: true, db.UnitPercent: true, db.UnitCount: true}
+
+func compileDefinition(def Definition) (*Metric, error) {
+	if !identifier.MatchString(def.Name) {
+		return nil, fmt.Errorf("invalid metric name")
+	}
+	if def.Unit == "" {
+		def.Unit = db.UnitCount
+	}
+	if !units[def.Unit] {
+		return nil, fmt.Errorf("unknown unit %q", def.Unit)
+	}
+	if def.Family == "" {
+		def.Family = DefaultFamily
+	}
+	if !identifier.MatchString(def.Family) {
+		return nil, fmt.Errorf("invalid family %q", def.Family)
+	}
+
+	metric := &Metric{Definition: def, TTL: defaultCacheTTL}
+	if def.CacheTTL != "" {
+		ttl, err := time.ParseDuration(def.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("cache_ttl: %w", err)
+		}
+		metric.TTL = ttl
+	}
+
+	if def.Formula != "" {
+		if def.Table != "" || def.Aggregation != "" {
+			return nil, fmt.Errorf("formula metrics cannot also set table or aggregation")
+		}
+		formula, err := parseFormula(def.Formula)
+		if err != nil {
+			return nil, fmt.Errorf("formula: %w", err)
+		}
+		metric.formula = formula
+		metric.deps = refs(formula)
+		return metric, nil
+	}
+
+	if !identifier.MatchString(def.Table) {
+		return nil, fmt.Errorf("invalid table %q", def.Table)
+	}
+	if !aggregations[def.Aggregation] {
+		return nil, fmt.Errorf("unknown aggregation %q", def.Aggregation)
+	}
+	if def.Expression == "" && def.Aggregation != "count" {
+		return nil, fmt.Errorf("%s needs an expression", def.Aggregation)
+	}
+	if def.DateColumn != "" && !identifier.MatchString(def.DateColumn) {
+		return nil, fmt.Errorf("invalid date_column %q", def.DateColumn)
+	}
+	switch def.Snapshot {
+	case "":
+	case "start", "end":
+		if def.DateColumn == "" {
+			return nil, fmt.Errorf("snapshot metrics need a date_column")
+		}
+	default:
+		return nil, fmt.Errorf("snapshot must be start or end")
+	}
+	for _, f := range def.Filters {
+		if !identifier.MatchString(f.Column) {
+			return nil, fmt.Errorf("invalid filter column %q", f.Column)
+		}
+		if _, ok := comparisons[f.Op]; !ok {
+			return nil, fmt.Errorf("unknown filter op %q", f.Op)
+		}
+		if (f.Op == "in" || f.Op == "not_in") && len(filterValues(f.Value)) == 0 {
+			return nil, fmt.Errorf("filter on %s needs at least one value", f.Column)
+		}
+	}
+	return metric, nil
+}
@@ -0,0 +1,168 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+)
+
+const revenueDefinition = `
+  - name: revenue
+    table: fact_orders
+    aggregation: sum
+    expression: net_amount
+    date_column: order_date
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics string
+		want    string
+	}{
+		{name: "valid", metrics: revenueDefinition + `
+  - name: half
+    formula: revenue / 2
+`},
+		{name: "defined twice", metrics: revenueDefinition + revenueDefinition, want: "revenue defined twice"},
+		{name: "unknown reference", metrics: revenueDefinition + `
+  - name: margin
+    formula: revenue - costs
+`, want: "formula references unknown metric costs"},
+		{name: "cycle", metrics: `
+  - name: a
+    formula: b + 1
+  - name: b
+    formula: a * 2
+`, want: "formula cycle"},
+		{name: "unbalanced formula", metrics: revenueDefinition + `
+  - name: half
+    formula: (revenue / 2
+`, want: "missing )"},
+		{name: "unknown function", metrics: revenueDefinition + `
+  - name: root
+    formula: sqrt(revenue)
+`, want: "unknown function sqrt"},
+		{name: "unknown aggregation", metrics: `
+  - name: revenue
+    table: fact_orders
+    aggregation: median
+    expression: net_amount
+`, want: `unknown aggregation "median"`},
+		{name: "snapshot without date column", metrics: `
+  - name: mrr
+    table: fact_mrr_snapshots
+    aggregation: sum
+    expression: mrr
+    snapshot: end
+`, want: "snapshot metrics need a date_column"},
+		{name: "formula with a table", metrics: `
+  - name: half
+    table: fact_orders
+    aggregation: sum
+    formula: 1 / 2
+`, want: "formula metrics cannot also set table or aggregation"},
+		{name: "trend on a trend", metrics: revenueDefinition + `
+  - name: a
+    table: fact_orders
+    aggregation: count
+    trend: b
+  - name: b
+    table: fact_orders
+    aggregation: count
+    trend: revenue
+`, want: "trend must name a metric without its own trend"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := metrics.Parse([]byte("metrics:" + tt.metrics))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []metrics.Filter
+		err  bool
+	}{
+		{raw: ""},
+		{raw: "plan_type:eq:enterprise", want: []metrics.Filter{{Column: "plan_type", Op: "eq", Value: "enterprise"}}},
+		{raw: "country_code:in:US|CA,account_id:ne:acct_002", want: []metrics.Filter{
+			{Column: "country_code", Op: "in", Value: []string{"US", "CA"}},
+			{Column: "account_id", Op: "ne", Value: "acct_002"},
+		}},
+		{raw: "industry:eq:a:b", want: []metrics.Filter{{Column: "industry", Op: "eq", Value: "a:b"}}},
+		{raw: "plan_type", err: true},
+		{raw: "plan_type:eq", err: true},
+		{raw: "plan_type:like:ent%", err: true},
+		{raw: "Plan-Type:eq:enterprise", err: true},
+		{raw: "plan_type:eq:enterprise,", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := metrics.ParseFilters(tt.raw)
+			if tt.err {
+				if !errors.Is(err, metrics.ErrInvalidFilter) {
+					t.Errorf("err = %v, want ErrInvalidFilter", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filters = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry, err := metrics.Parse([]byte("metrics:" + revenueDefinition + `
+  - name: unbounded
+    formula: revenue / (revenue - revenue) + 1
+    unit: currency
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := registry.Evaluate(ctx, warehouse, "unbounded", metrics.Params{StartDate: day(-9), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Value != 1 {
+		t.Errorf("value = %v, want 1", value.Value)
+	}
+
+	// Before the seeded facts every denominator is zero.
+	empty := metrics.Params{StartDate: day(-400), EndDate: day(-390)}
+	defaults := metrics.NewRegistry()
+	for _, name := range []string{"arpu", "conversion_rate", "nrr", "churn_rate", "ltv", "cac", "refund_rate"} {
+		t.Run(name, func(t *testing.T) {
+			value, err := defaults.Evaluate(ctx, warehouse, name, empty)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value.Value != 0 {
+				t.Errorf("value = %v, want 0", value.Value)
+			}
+		})
+	}
+}
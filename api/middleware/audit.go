@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/audit"
+)
+
+// Audit records every request to the audit log: who made it, the route and
+// account it read, its query parameters, status and latency. It runs before
+// AuthMiddleware, so refused requests are recorded too. A request whose
+// entry cannot be written fails with a 500 rather than go unrecorded.
+func Audit(log *audit.Log) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		// Until a route handles the request, c.Route() is a middleware's,
+		// mounted where this one is.
+		mount := c.Route().Path
+		err := c.Next()
+
+		entry := audit.Entry{
+			Time:      start,
+			Method:    c.Method(),
+			Path:      c.Path(),
+			Params:    c.Queries(),
+			Status:    c.Response().StatusCode(),
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			IP:        c.IP(),
+		}
+		if route := c.Route().Path; route != mount {
+			entry.Route = route
+		}
+		if err != nil {
+			entry.Status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				entry.Status = fiberErr.Code
+			}
+		}
+		principal, ok := CurrentPrincipal(c)
+		if ok {
+			entry.Principal = principal.ID
+			entry.Roles = principal.Roles
+		}
+		entry.Accounts = auditAccounts(c, principal)
+
+		if recordErr := log.Record(c.Context(), entry); recordErr != nil {
+			return recordErr
+		}
+		return err
+	}
+}
+
+// auditAccounts is the account scope of a request: the account EnforceRBAC
+// scoped it to or it asked for, the accounts a listing was limited to, "*"
+// when an unscoped caller read every account, and none otherwise.
+func auditAccounts(c *fiber.Ctx, principal *Principal) []string {
+	if scoped, ok := c.Locals("account_id").(string); ok && scoped != "" {
+		return []string{scoped}
+	}
+	if scope := AccountScope(c); len(scope) > 0 {
+		return scope
+	}
+	if requested := c.Params("account_id"); requested != "" {
+		return []string{requested}
+	}
+	if requested := c.Query("account_id"); requested != "" {
+		return []string{requested}
+	}
+	if principal != nil && principal.AllAccounts() {
+		return []string{AllAccounts}
+	}
+	return nil
+}
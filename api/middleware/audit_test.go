@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/audit"
+	"revenue-dashboard-api/audit/audittest"
+)
+
+const auditPolicy = `
+roles:
+  viewer:
+    families: [general, revenue]
+default_roles: [viewer]
+principals:
+  - id: reader
+    roles: [viewer]
+    accounts: [acct_001, acct_003]
+    api_keys: [k_reader]
+  - id: ops
+    roles: [viewer]
+    accounts: ["*"]
+    api_keys: [k_ops]
+`
+
+func TestAuditRecordsEachAccount(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "")
+	policy := parsePolicy(t, auditPolicy)
+	log := audittest.Open(t)
+
+	app := fiber.New()
+	app.Use(Audit(log), AuthMiddleware(policy, nil, nil))
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Get("/accounts", EnforceRBACListing(Family("revenue")), ok)
+	app.Get("/metrics", EnforceRBAC(Family("revenue")), ok)
+
+	for _, request := range []struct{ path, key string }{
+		{"/accounts", "k_reader"},
+		{"/metrics?account_id=acct_003", "k_reader"},
+		{"/accounts", "k_ops"},
+		{"/metrics?account_id=acct_002", "k_reader"},
+	} {
+		get(t, app, request.path, request.key)
+	}
+
+	tests := []struct {
+		account string
+		want    []string
+	}{
+		{account: "acct_001", want: []string{"/accounts acct_001,acct_003"}},
+		{account: "acct_003", want: []string{"/metrics acct_003", "/accounts acct_001,acct_003"}},
+		{account: "acct_002", want: []string{"/metrics acct_002"}},
+		{account: "*", want: []string{"/accounts *"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.account, func(t *testing.T) {
+			entries, err := log.Query(context.Background(), audit.Filter{Account: tt.account})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(entries))
+			for i, entry := range entries {
+				got[i] = entry.Path + " " + strings.Join(entry.Accounts, ",")
+			}
+			if strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
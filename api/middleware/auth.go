@@ -1,17 +1,33 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"os"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/apikeys"
 )
 
-func AuthMiddleware() fiber.Handler {
+// AuthMiddleware authenticates the caller as a Principal for EnforceRBAC.
+// Keys issued by the key store carry the roles and accounts they were
+// created with. When tokens is set, a bearer JWT it verifies maps to the
+// principal its claims name. Keys of the policy's principals carry their
+// roles and accounts; keys in API_KEYS ("key:account" or "key:*") and
+// API_KEY hold the policy's default roles. Without any keys or token
+// verifier configured, and before the key store issued its first key, every
+// caller is anonymous and holds the policy's anonymous roles on every
+// account.
+func AuthMiddleware(policy *Policy, tokens *TokenVerifier, keys *apikeys.Store) fiber.Handler {
+	keyMap := parseKeyMap(os.Getenv("API_KEYS"))
+	requiredKey := os.Getenv("API_KEY")
+
 	return func(c *fiber.Ctx) error {
-		keyMap := parseKeyMap(os.Getenv("API_KEYS"))
-		requiredKey := os.Getenv("API_KEY")
-		if requiredKey == "" && len(keyMap) == 0 {
+		if requiredKey == "" && len(keyMap) == 0 && !policy.HasKeys() && tokens == nil && (keys == nil || !keys.HasKeys()) {
+			c.Locals(principalKey, policy.Anonymous(anonymousID))
 			return c.Next()
 		}
 
@@ -25,35 +41,64 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
-		if len(keyMap) > 0 {
-			accountScope, ok := keyMap[provided]
-			if !ok {
+		if keys != nil && strings.HasPrefix(provided, apikeys.Prefix) {
+			key, err := keys.Authenticate(c.Context(), provided)
+			switch {
+			case errors.Is(err, apikeys.ErrRevoked) || errors.Is(err, apikeys.ErrExpired):
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error":   "unauthorized",
+					"message": err.Error(),
+				})
+			case errors.Is(err, apikeys.ErrUnknownKey):
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 					"error": "unauthorized",
 				})
+			case err != nil:
+				return err
 			}
-			if accountScope != "*" {
-				requested := c.Query("account_id")
-				if requested != "" && requested != accountScope {
-					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-						"error": "forbidden",
-					})
-				}
-				c.Locals("account_id", accountScope)
+			c.Locals(principalKey, policy.Resolve(key.ID, key.Roles, key.Accounts))
+			return c.Next()
+		}
+		if tokens != nil && strings.Count(provided, ".") == 2 {
+			claims, err := tokens.Verify(c.Context(), provided)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error":   "unauthorized",
+					"message": err.Error(),
+				})
 			}
+			c.Locals(principalKey, policy.ForToken(claims))
 			return c.Next()
 		}
-
-		if provided != requiredKey {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "unauthorized",
-			})
+		if principal, ok := policy.ForKey(provided); ok {
+			c.Locals(principalKey, principal)
+			return c.Next()
+		}
+		if accountScope, ok := keyMap[provided]; ok {
+			c.Locals(principalKey, policy.Default(legacyKeyID(provided), []string{accountScope}))
+			return c.Next()
+		}
+		if requiredKey != "" && provided == requiredKey {
+			c.Locals(principalKey, policy.Default(legacyKeyID(provided), []string{AllAccounts}))
+			return c.Next()
 		}
 
-		return c.Next()
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
 	}
 }
 
+// anonymousID is the principal of callers when no credentials are configured.
+const anonymousID = "anonymous"
+
+// legacyKeyID names the principal of an API_KEY or API_KEYS key by a
+// fingerprint, so keys are told apart without logging them.
+func legacyKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "api_key:" + hex.EncodeToString(sum[:6])
+}
+
 func parseBearer(value string) string {
 	if value == "" {
 		return ""
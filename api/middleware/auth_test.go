@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/apikeys"
+	"revenue-dashboard-api/apikeys/apikeystest"
+)
+
+const testPolicy = `
+roles:
+  viewer:
+    families: [general, revenue]
+  admin:
+    families: ["*"]
+default_roles: [viewer]
+principals:
+  - id: ops
+    roles: [admin]
+    accounts: ["*"]
+    api_keys: [k_ops]
+`
+
+// authApp serves the principal AuthMiddleware resolved as "id roles accounts".
+func authApp(policy *Policy, keys *apikeys.Store) *fiber.App {
+	app := fiber.New()
+	app.Use(AuthMiddleware(policy, nil, keys))
+	app.Get("/", func(c *fiber.Ctx) error {
+		principal, _ := CurrentPrincipal(c)
+		return c.SendString(principal.ID + " " + strings.Join(principal.Roles, ",") + " " + strings.Join(principal.Accounts, ","))
+	})
+	return app
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	policy := parsePolicy(t, testPolicy)
+	open := parsePolicy(t, "roles:\n  viewer:\n    families: [general]\ndefault_roles: [viewer]\n")
+
+	tests := []struct {
+		name    string
+		policy  *Policy
+		apiKeys string
+		key     string
+		status  int
+		want    string
+	}{
+		{name: "nothing configured is anonymous viewer", policy: open, status: 200, want: "anonymous viewer *"},
+		{name: "anonymous roles when set", policy: parsePolicy(t, "roles:\n  viewer:\n    families: [general]\n  finance:\n    families: [revenue]\ndefault_roles: [viewer]\nanonymous_roles: [finance]\n"), status: 200, want: "anonymous finance *"},
+		{name: "policy key", policy: policy, key: "k_ops", status: 200, want: "ops admin *"},
+		{name: "missing key", policy: policy, status: 401},
+		{name: "wrong key", policy: policy, key: "nope", status: 401},
+		{name: "legacy account key holds default roles", policy: policy, apiKeys: "tenantkey:acct_002", key: "tenantkey", status: 200, want: " viewer acct_002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEY", "")
+			t.Setenv("API_KEYS", tt.apiKeys)
+			status, body := get(t, authApp(tt.policy, nil), "/", tt.key)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", status, tt.status, body)
+			}
+			if tt.want != "" && !strings.HasSuffix(body, tt.want) {
+				t.Errorf("principal = %q, want suffix %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareKeyStore(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "")
+	ctx := context.Background()
+	policy := parsePolicy(t, "roles:\n  admin:\n    families: [\"*\"]\ndefault_roles: [admin]\n")
+	keys := apikeystest.Open(t)
+	app := authApp(policy, keys)
+
+	if status, _ := get(t, app, "/", ""); status != 200 {
+		t.Fatalf("before any key: status = %d, want 200", status)
+	}
+	key, secret, err := keys.Create(ctx, "first", []string{"admin"}, []string{"*"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := get(t, app, "/", ""); status != 401 {
+		t.Fatalf("anonymous with a key issued: status = %d, want 401", status)
+	}
+	if status, body := get(t, app, "/", secret); status != 200 || !strings.HasPrefix(body, key.ID+" admin *") {
+		t.Fatalf("with the key: %d %q", status, body)
+	}
+	if _, err := keys.Revoke(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "anonymous after every key is revoked"},
+		{name: "revoked key", key: secret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, body := get(t, app, "/", tt.key); status != 401 {
+				t.Errorf("status = %d, want 401 (%s)", status, body)
+			}
+		})
+	}
+}
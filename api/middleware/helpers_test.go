@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newTestIssuer(t *testing.T) *TestIssuer {
+	t.Helper()
+	issuer := &TestIssuer{}
+	if err := issuer.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func sign(t *testing.T, issuer *TestIssuer, alg, subject string, ttl time.Duration) string {
+	t.Helper()
+	token, err := issuer.Sign(alg, subject, []string{"viewer"}, []string{"acct_001"}, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// withHeader replaces a token's header, keeping its claims and signature.
+func withHeader(token string, header map[string]string) string {
+	raw, _ := json.Marshal(header)
+	parts := strings.SplitN(token, ".", 2)
+	return base64.RawURLEncoding.EncodeToString(raw) + "." + parts[1]
+}
+
+func parsePolicy(t *testing.T, raw string) *Policy {
+	t.Helper()
+	policy, err := ParsePolicy([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+// get sends a GET with the API key, if any, and returns the status and body.
+func get(t *testing.T, app *fiber.App, path, key string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	testIssuerName      = "revenue-dashboard-test-issuer"
+	defaultTestTokenTTL = time.Hour
+)
+
+// TestIssuer is an in-process token issuer for development and tests. It
+// signs RS256 and ES256 tokens with keys it generates at startup and
+// publishes them as a JWKS, so JWT auth can be exercised end to end without
+// an external identity provider. Rotate replaces the signing keys and keeps
+// the previous ones published, as an IdP does during rotation.
+type TestIssuer struct {
+	mu         sync.RWMutex
+	generation int
+	current    map[string]issuerKey
+	previous   map[string]issuerKey
+}
+
+type issuerKey struct {
+	kid    string
+	signer crypto.Signer
+}
+
+// NewTestIssuer starts the test issuer when JWT_TEST_ISSUER is set, and
+// returns nil otherwise. Anyone who can reach its token endpoint can mint
+// tokens with any roles, so it must never be enabled in production.
+func NewTestIssuer() *TestIssuer {
+	if enabled, _ := strconv.ParseBool(os.Getenv("JWT_TEST_ISSUER")); !enabled {
+		return nil
+	}
+	issuer := &TestIssuer{}
+	if err := issuer.Rotate(); err != nil {
+		panic(err)
+	}
+	log.Printf("JWT_TEST_ISSUER is set: tokens from the test issuer are trusted")
+	return issuer
+}
+
+// Name is the iss claim of the tokens the issuer signs.
+func (i *TestIssuer) Name() string {
+	return testIssuerName
+}
+
+// Rotate generates new RS256 and ES256 signing keys. Tokens signed with the
+// replaced keys stay valid until the next rotation.
+func (i *TestIssuer) Rotate() error {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("test issuer: %w", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("test issuer: %w", err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.generation++
+	i.previous = i.current
+	i.current = map[string]issuerKey{
+		AlgRS256: {kid: "rs256-" + strconv.Itoa(i.generation), signer: rsaKey},
+		AlgES256: {kid: "es256-" + strconv.Itoa(i.generation), signer: ecKey},
+	}
+	return nil
+}
+
+// Key implements KeySource over the current and previous keys.
+func (i *TestIssuer) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, keys := range []map[string]issuerKey{i.current, i.previous} {
+		for _, key := range keys {
+			if key.kid == kid {
+				return key.signer.Public(), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// Sign issues a token for subject with the given roles and accounts.
+func (i *TestIssuer) Sign(alg, subject string, roles, accounts []string, ttl time.Duration) (string, error) {
+	i.mu.RLock()
+	key, ok := i.current[alg]
+	i.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("test issuer: alg must be %s or %s", AlgRS256, AlgES256)
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": key.kid, "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":      testIssuerName,
+		"sub":      subject,
+		"roles":    roles,
+		"accounts": accounts,
+		"iat":      now.Unix(),
+		"exp":      now.Add(ttl).Unix(),
+	})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch signer := key.signer.(type) {
+	case *rsa.PrivateKey:
+		raw, err := rsa.SignPKCS1v15(rand.Reader, signer, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("test issuer: %w", err)
+		}
+		signature = raw
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, signer, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("test issuer: %w", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// JWKSHandler publishes the current and previous public keys.
+func (i *TestIssuer) JWKSHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		i.mu.RLock()
+		defer i.mu.RUnlock()
+		set := jsonWebKeySet{Keys: []jsonWebKey{}}
+		for _, keys := range []map[string]issuerKey{i.current, i.previous} {
+			for _, alg := range []string{AlgRS256, AlgES256} {
+				if key, ok := keys[alg]; ok {
+					set.Keys = append(set.Keys, publicJWK(alg, key))
+				}
+			}
+		}
+		return c.JSON(set)
+	}
+}
+
+type testTokenRequest struct {
+	Subject  string   `json:"sub"`
+	Roles    []string `json:"roles"`
+	Accounts []string `json:"accounts"`
+	Alg      string   `json:"alg"`
+	TTL      string   `json:"ttl"`
+}
+
+// TokenHandler signs a token for the subject, roles and accounts in the
+// JSON body. alg defaults to RS256 and ttl to one hour.
+func (i *TestIssuer) TokenHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req testTokenRequest
+		if err := c.BodyParser(&req); err != nil || req.Subject == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "invalid_parameter",
+				"message": "body must be JSON with at least sub",
+			})
+		}
+		if req.Alg == "" {
+			req.Alg = AlgRS256
+		}
+		ttl := defaultTestTokenTTL
+		if req.TTL != "" {
+			parsed, err := time.ParseDuration(req.TTL)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "invalid_parameter",
+					"message": "ttl must be a duration such as 15m",
+				})
+			}
+			ttl = parsed
+		}
+		token, err := i.Sign(req.Alg, req.Subject, req.Roles, req.Accounts, ttl)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "invalid_parameter",
+				"message": err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int(ttl.Seconds()),
+		})
+	}
+}
+
+// RotateHandler rotates the signing keys.
+func (i *TestIssuer) RotateHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := i.Rotate(); err != nil {
+			return err
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func publicJWK(alg string, key issuerKey) jsonWebKey {
+	encode := func(n *big.Int, size int) string {
+		return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, size)))
+	}
+	jwk := jsonWebKey{Kid: key.kid, Use: "sig", Alg: alg}
+	switch public := key.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = encode(public.X, 32)
+		jwk.Y = encode(public.Y, 32)
+	}
+	return jwk
+}
@@ -0,0 +1,368 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signing algorithms accepted on bearer tokens.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+const (
+	defaultJWKSTTL = 10 * time.Minute
+	// jwksRetry spaces out refetches after one failed or still lacked the
+	// kid asked for, so tokens with made-up kids can't make every request
+	// hit the IdP.
+	jwksRetry = 30 * time.Second
+	// tokenLeeway absorbs clock skew between the IdP and the API.
+	tokenLeeway = time.Minute
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// KeySource returns the public key a token's kid names.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// TokenConfig says which tokens to accept and where their claims live.
+// Issuer and Audience are only checked when set.
+type TokenConfig struct {
+	Issuer        string
+	Audience      string
+	UserClaim     string
+	RolesClaim    string
+	AccountsClaim string
+}
+
+// TokenVerifier validates signed JWTs against the keys of a KeySource.
+type TokenVerifier struct {
+	keys   KeySource
+	config TokenConfig
+}
+
+// Claims is what a verified token says about its subject. Roles and
+// Accounts are nil when the token does not carry the claim.
+type Claims struct {
+	Subject  string
+	Roles    []string
+	Accounts []string
+}
+
+func NewTokenVerifier(keys KeySource, config TokenConfig) *TokenVerifier {
+	if config.UserClaim == "" {
+		config.UserClaim = "sub"
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = "roles"
+	}
+	if config.AccountsClaim == "" {
+		config.AccountsClaim = "accounts"
+	}
+	return &TokenVerifier{keys: keys, config: config}
+}
+
+// NewTokenVerifierFromEnv verifies tokens against the JWKS at JWT_JWKS_URL,
+// or against the keys of issuer when no URL is set. It returns nil, leaving
+// JWT auth off, when neither is configured.
+func NewTokenVerifierFromEnv(issuer *TestIssuer) *TokenVerifier {
+	config := TokenConfig{
+		Issuer:        os.Getenv("JWT_ISSUER"),
+		Audience:      os.Getenv("JWT_AUDIENCE"),
+		UserClaim:     os.Getenv("JWT_USER_CLAIM"),
+		RolesClaim:    os.Getenv("JWT_ROLES_CLAIM"),
+		AccountsClaim: os.Getenv("JWT_ACCOUNTS_CLAIM"),
+	}
+	if url := os.Getenv("JWT_JWKS_URL"); url != "" {
+		ttl := defaultJWKSTTL
+		if raw := os.Getenv("JWT_JWKS_TTL"); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil || parsed <= 0 {
+				panic(fmt.Sprintf("JWT_JWKS_TTL: invalid duration %q", raw))
+			}
+			ttl = parsed
+		}
+		return NewTokenVerifier(NewJWKS(url, ttl), config)
+	}
+	if issuer != nil {
+		if config.Issuer == "" {
+			config.Issuer = issuer.Name()
+		}
+		return NewTokenVerifier(issuer, config)
+	}
+	return nil
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks a compact JWT's signature, expiry, not-before, issuer and
+// audience and returns its claims.
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, err
+	}
+	if header.Alg != AlgRS256 && header.Alg != AlgES256 {
+		return Claims{}, fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, digest[:], signature) {
+		return Claims{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, err
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return Claims{}, fmt.Errorf("%w: no exp claim", ErrInvalidToken)
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(tokenLeeway)) {
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(tokenLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return Claims{}, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if v.config.Issuer != "" && claims["iss"] != v.config.Issuer {
+		return Claims{}, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	}
+	if v.config.Audience != "" && !contains(claimStrings(claims["aud"]), v.config.Audience) {
+		return Claims{}, fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	}
+
+	subject, _ := claims[v.config.UserClaim].(string)
+	if subject == "" {
+		return Claims{}, fmt.Errorf("%w: no %s claim", ErrInvalidToken, v.config.UserClaim)
+	}
+	return Claims{
+		Subject:  subject,
+		Roles:    claimStrings(claims[v.config.RolesClaim]),
+		Accounts: claimStrings(claims[v.config.AccountsClaim]),
+	}, nil
+}
+
+func decodeSegment(segment string, into interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(raw, into); err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) bool {
+	switch alg {
+	case AlgRS256:
+		public, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(public, crypto.SHA256, digest, signature) == nil
+	case AlgES256:
+		public, ok := key.(*ecdsa.PublicKey)
+		if !ok || public.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(public, digest, r, s)
+	}
+	return false
+}
+
+// claimStrings reads a claim holding a list of strings, or one
+// space-separated string as OAuth scopes are. A missing claim is nil.
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// JWKS fetches and caches the signing keys a JSON Web Key Set URL
+// publishes. The set is refetched once it is older than the TTL, and early
+// when a token names a kid the cached set lacks, which is how rotated keys
+// are picked up. A failed refetch keeps serving the cached keys.
+type JWKS struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	missedAt  time.Time
+}
+
+func NewJWKS(url string, ttl time.Duration) *JWKS {
+	return &JWKS{url: url, ttl: ttl, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key, known := j.keys[kid]
+	now := time.Now()
+	refresh := j.keys == nil || !known || now.Sub(j.fetchedAt) > j.ttl
+	if refresh && now.Sub(j.missedAt) > jwksRetry {
+		keys, err := fetchJWKS(ctx, j.client, j.url)
+		if err != nil {
+			log.Printf("jwks: %v", err)
+			j.missedAt = now
+		} else {
+			j.keys, j.fetchedAt = keys, now
+			if key, known = keys[kid]; !known {
+				j.missedAt = now
+			}
+		}
+	}
+	if j.keys == nil {
+		return nil, fmt.Errorf("%w: no keys fetched from %s yet", ErrUnknownKey, j.url)
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, url string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: status %d", url, resp.StatusCode)
+	}
+	var set jsonWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("jwks: skipping key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(field string) (*big.Int, error) {
+		raw, err := base64.RawURLEncoding.DecodeString(field)
+		if err != nil || len(raw) == 0 {
+			return nil, errors.New("malformed key parameter")
+		}
+		return new(big.Int).SetBytes(raw), nil
+	}
+	switch {
+	case k.Kty == "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("malformed RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, errors.New("point not on P-256")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s %s", k.Kty, k.Crv)
+}
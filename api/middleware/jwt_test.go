@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+	other := newTestIssuer(t)
+	if err := other.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rs256 := sign(t, issuer, AlgRS256, "u1", time.Hour)
+	parts := strings.Split(rs256, ".")
+
+	tests := []struct {
+		name    string
+		config  TokenConfig
+		token   string
+		subject string
+		err     error
+	}{
+		{name: "rs256", token: rs256, subject: "u1"},
+		{name: "es256", token: sign(t, issuer, AlgES256, "u2", time.Hour), subject: "u2"},
+		{name: "issuer checked", config: TokenConfig{Issuer: testIssuerName}, token: rs256, subject: "u1"},
+		{name: "wrong issuer", config: TokenConfig{Issuer: "someone-else"}, token: rs256, err: ErrInvalidToken},
+		{name: "wrong audience", config: TokenConfig{Audience: "dashboard"}, token: rs256, err: ErrInvalidToken},
+		{name: "expired", token: sign(t, issuer, AlgRS256, "u1", -2*tokenLeeway), err: ErrInvalidToken},
+		{name: "within leeway", token: sign(t, issuer, AlgES256, "u1", -tokenLeeway/2), subject: "u1"},
+		{name: "unknown kid", token: sign(t, other, AlgRS256, "u1", time.Hour), err: ErrUnknownKey},
+		{name: "kid of another key", token: withHeader(rs256, map[string]string{"alg": AlgES256, "kid": "es256-1"}), err: ErrInvalidToken},
+		{name: "tampered claims", token: parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999}`)) + "." + parts[2], err: ErrInvalidToken},
+		{name: "unsupported alg", token: withHeader(rs256, map[string]string{"alg": "HS256", "kid": "rs256-1"}), err: ErrInvalidToken},
+		{name: "not a jwt", token: "abc.def", err: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := NewTokenVerifier(issuer, tt.config).Verify(context.Background(), tt.token)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != tt.subject {
+				t.Errorf("subject = %q, want %q", claims.Subject, tt.subject)
+			}
+		})
+	}
+}
+
+func TestClaimStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []string
+	}{
+		{name: "missing", value: nil, want: nil},
+		{name: "list", value: []interface{}{"viewer", "", "analyst", 3}, want: []string{"viewer", "analyst"}},
+		{name: "space separated", value: "viewer  analyst", want: []string{"viewer", "analyst"}},
+		{name: "other", value: 3.0, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := claimStrings(tt.value)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") || (got == nil) != (tt.want == nil) {
+				t.Errorf("claimStrings(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// jwksServer publishes the issuer's keys and counts the fetches.
+func jwksServer(t *testing.T, issuer *TestIssuer) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	fetches := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		issuer.mu.RLock()
+		defer issuer.mu.RUnlock()
+		set := jsonWebKeySet{Keys: []jsonWebKey{}}
+		for _, keys := range []map[string]issuerKey{issuer.current, issuer.previous} {
+			for alg, key := range keys {
+				set.Keys = append(set.Keys, publicJWK(alg, key))
+			}
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+	return server, fetches
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	issuer := newTestIssuer(t)
+	server, fetches := jwksServer(t, issuer)
+	verifier := NewTokenVerifier(NewJWKS(server.URL, time.Hour), TokenConfig{})
+	ctx := context.Background()
+	first := sign(t, issuer, AlgRS256, "u1", time.Hour)
+
+	steps := []struct {
+		name    string
+		token   func() string
+		err     error
+		fetches int32
+	}{
+		{name: "first use fetches", token: func() string { return first }, fetches: 1},
+		{name: "cached", token: func() string { return sign(t, issuer, AlgES256, "u1", time.Hour) }, fetches: 1},
+		{name: "rotated kid refetches", token: func() string {
+			if err := issuer.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+			return sign(t, issuer, AlgRS256, "u1", time.Hour)
+		}, fetches: 2},
+		{name: "previous key still valid", token: func() string { return first }, fetches: 2},
+		{name: "unknown kid refetches once", token: func() string {
+			return withHeader(first, map[string]string{"alg": AlgRS256, "kid": "made-up"})
+		}, err: ErrUnknownKey, fetches: 3},
+		{name: "unknown kid again waits", token: func() string {
+			return withHeader(first, map[string]string{"alg": AlgRS256, "kid": "made-up-too"})
+		}, err: ErrUnknownKey, fetches: 3},
+	}
+	for _, step := range steps {
+		_, err := verifier.Verify(ctx, step.token())
+		if step.err == nil && err != nil || step.err != nil && !errors.Is(err, step.err) {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.err)
+		}
+		if got := fetches.Load(); got != step.fetches {
+			t.Fatalf("%s: %d fetches, want %d", step.name, got, step.fetches)
+		}
+	}
+}
+
+func TestForToken(t *testing.T) {
+	policy := parsePolicy(t, `
+roles:
+  viewer:
+    families: [general, revenue]
+  finance:
+    families: [general, revenue, marketing]
+default_roles: [viewer]
+principals:
+  - id: alice
+    roles: [finance]
+    accounts: [acct_001]
+`)
+
+	tests := []struct {
+		name      string
+		claims    Claims
+		roles     string
+		accounts  string
+		marketing bool
+	}{
+		{name: "claims carry scope", claims: Claims{Subject: "bob", Roles: []string{"finance"}, Accounts: []string{"acct_002"}}, roles: "finance", accounts: "acct_002", marketing: true},
+		{name: "listed principal fills in", claims: Claims{Subject: "alice"}, roles: "finance", accounts: "acct_001", marketing: true},
+		{name: "claims win over policy", claims: Claims{Subject: "alice", Roles: []string{"viewer"}}, roles: "viewer", accounts: "acct_001"},
+		{name: "unlisted without claims gets nothing", claims: Claims{Subject: "carol"}},
+		{name: "unknown roles grant nothing", claims: Claims{Subject: "dave", Roles: []string{"admin"}, Accounts: []string{"*"}}, roles: "admin", accounts: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal := policy.ForToken(tt.claims)
+			if principal.ID != tt.claims.Subject {
+				t.Errorf("id = %q, want %q", principal.ID, tt.claims.Subject)
+			}
+			if got := strings.Join(principal.Roles, ","); got != tt.roles {
+				t.Errorf("roles = %q, want %q", got, tt.roles)
+			}
+			if got := strings.Join(principal.Accounts, ","); got != tt.accounts {
+				t.Errorf("accounts = %q, want %q", got, tt.accounts)
+			}
+			if principal.Can("marketing") != tt.marketing {
+				t.Errorf("Can(marketing) = %v, want %v", principal.Can("marketing"), tt.marketing)
+			}
+		})
+	}
+}
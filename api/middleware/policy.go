@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed policy.yml
+var defaultPolicy []byte
+
+// AllAccounts among a principal's accounts grants every account; AllFamilies
+// among a role's families grants every family.
+const (
+	AllAccounts = "*"
+	AllFamilies = "*"
+)
+
+type Role struct {
+	Families []string `yaml:"families"`
+}
+
+type PrincipalPolicy struct {
+	ID       string   `yaml:"id"`
+	Roles    []string `yaml:"roles"`
+	Accounts []string `yaml:"accounts"`
+	APIKeys  []string `yaml:"api_keys"`
+}
+
+// Policy maps roles to the metric families they may read and principals to
+// their roles and accounts.
+type Policy struct {
+	Roles          map[string]Role   `yaml:"roles"`
+	DefaultRoles   []string          `yaml:"default_roles"`
+	AnonymousRoles []string          `yaml:"anonymous_roles"`
+	Principals     []PrincipalPolicy `yaml:"principals"`
+
+	keys map[string]*PrincipalPolicy
+	ids  map[string]*PrincipalPolicy
+}
+
+// LoadPolicy reads the policy from path, or the policy bundled with the
+// binary when path is empty.
+func LoadPolicy(path string) (*Policy, error) {
+	raw := defaultPolicy
+	if path != "" {
+		var err error
+		raw, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ParsePolicy(raw)
+}
+
+func NewPolicy() *Policy {
+	policy, err := LoadPolicy(os.Getenv("POLICY_FILE"))
+	if err != nil {
+		panic(err)
+	}
+	return policy
+}
+
+func ParsePolicy(raw []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("policy: %w", err)
+	}
+	if err := p.checkRoles("default_roles", p.DefaultRoles); err != nil {
+		return nil, err
+	}
+	if err := p.checkRoles("anonymous_roles", p.AnonymousRoles); err != nil {
+		return nil, err
+	}
+
+	p.keys = map[string]*PrincipalPolicy{}
+	p.ids = map[string]*PrincipalPolicy{}
+	for i := range p.Principals {
+		principal := &p.Principals[i]
+		if principal.ID == "" {
+			return nil, fmt.Errorf("policy: principal %d has no id", i+1)
+		}
+		if _, taken := p.ids[principal.ID]; taken {
+			return nil, fmt.Errorf("policy: principal %s defined twice", principal.ID)
+		}
+		p.ids[principal.ID] = principal
+		if err := p.checkRoles("principal "+principal.ID, principal.Roles); err != nil {
+			return nil, err
+		}
+		if len(principal.Accounts) == 0 {
+			return nil, fmt.Errorf("policy: principal %s has no accounts", principal.ID)
+		}
+		for _, key := range principal.APIKeys {
+			if _, taken := p.keys[key]; taken || key == "" {
+				return nil, fmt.Errorf("policy: principal %s: api key empty or shared with another principal", principal.ID)
+			}
+			p.keys[key] = principal
+		}
+	}
+	return &p, nil
+}
+
+func (p *Policy) checkRoles(owner string, roles []string) error {
+	for _, role := range roles {
+		if _, ok := p.Roles[role]; !ok {
+			return fmt.Errorf("policy: %s: unknown role %s", owner, role)
+		}
+	}
+	return nil
+}
+
+// HasRole reports whether the policy defines a role.
+func (p *Policy) HasRole(role string) bool {
+	_, ok := p.Roles[role]
+	return ok
+}
+
+// Delegable reports whether principal may grant role to another, such as a
+// key it creates: the role must grant no family the principal's own roles
+// don't.
+func (p *Policy) Delegable(principal *Principal, role string) bool {
+	definition, ok := p.Roles[role]
+	if !ok {
+		return false
+	}
+	for _, family := range definition.Families {
+		if !principal.Can(family) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasKeys reports whether any principal authenticates with an API key.
+func (p *Policy) HasKeys() bool {
+	return len(p.keys) > 0
+}
+
+// ForKey returns the principal an API key authenticates as.
+func (p *Policy) ForKey(key string) (*Principal, bool) {
+	principal, ok := p.keys[key]
+	if !ok {
+		return nil, false
+	}
+	return p.Resolve(principal.ID, principal.Roles, principal.Accounts), true
+}
+
+// ForToken returns the principal a verified token authenticates as. Roles
+// and accounts the token does not carry come from the principal the policy
+// lists under the token's subject; without one the token grants nothing.
+func (p *Policy) ForToken(claims Claims) *Principal {
+	roles, accounts := claims.Roles, claims.Accounts
+	if listed, ok := p.ids[claims.Subject]; ok {
+		if roles == nil {
+			roles = listed.Roles
+		}
+		if accounts == nil {
+			accounts = listed.Accounts
+		}
+	}
+	return p.Resolve(claims.Subject, roles, accounts)
+}
+
+// Default returns a principal the policy does not list, holding the default
+// roles.
+func (p *Policy) Default(id string, accounts []string) *Principal {
+	return p.Resolve(id, p.DefaultRoles, accounts)
+}
+
+// Anonymous returns the principal of callers when no credentials are
+// configured: it reads every account with the anonymous roles, or the
+// default roles when the policy sets none.
+func (p *Policy) Anonymous(id string) *Principal {
+	roles := p.AnonymousRoles
+	if roles == nil {
+		roles = p.DefaultRoles
+	}
+	return p.Resolve(id, roles, []string{AllAccounts})
+}
+
+// Resolve builds a principal from its roles, expanding them into the
+// families they grant. Unknown roles grant nothing.
+func (p *Policy) Resolve(id string, roles, accounts []string) *Principal {
+	principal := &Principal{ID: id, Roles: roles, Accounts: accounts, families: map[string]bool{}}
+	for _, role := range roles {
+		for _, family := range p.Roles[role].Families {
+			principal.families[family] = true
+		}
+	}
+	return principal
+}
+
+// Principal is an authenticated caller: who it is, its roles and the
+// accounts it may read.
+type Principal struct {
+	ID       string
+	Roles    []string
+	Accounts []string
+
+	families map[string]bool
+}
+
+// Can reports whether the principal's roles grant a metric family.
+func (p *Principal) Can(family string) bool {
+	return p.families[AllFamilies] || p.families[family]
+}
+
+// Families lists the families the principal's roles grant, sorted.
+func (p *Principal) Families() []string {
+	families := make([]string, 0, len(p.families))
+	for family := range p.families {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	return families
+}
+
+func (p *Principal) AllAccounts() bool {
+	for _, account := range p.Accounts {
+		if account == AllAccounts {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasAccount(accountID string) bool {
+	if p.AllAccounts() {
+		return true
+	}
+	for _, account := range p.Accounts {
+		if account == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentPrincipal returns the principal AuthMiddleware authenticated.
+func CurrentPrincipal(c *fiber.Ctx) (*Principal, bool) {
+	principal, ok := c.Locals(principalKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+const principalKey = "principal"
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/ratelimit"
+)
+
+// RateLimits throttles each caller and each account it reads with token
+// buckets, and refuses callers and accounts that used up their daily quota
+// of warehouse bytes. RATE_LIMIT_KEY (default 600/m) and RATE_LIMIT_ACCOUNT
+// (default 1200/m) set the buckets; QUOTA_KEY_BYTES_PER_DAY and
+// QUOTA_ACCOUNT_BYTES_PER_DAY set the quotas, off by default. A request's
+// bytes are only known once it ran, so the request that crosses a quota is
+// served and the next one refused. Refused requests get a 429 with
+// Retry-After.
+type RateLimits struct {
+	limiter      *ratelimit.Limiter
+	keyLimit     ratelimit.Limit
+	accountLimit ratelimit.Limit
+	keyQuota     int64
+	accountQuota int64
+}
+
+func NewRateLimits(limiter *ratelimit.Limiter) *RateLimits {
+	return &RateLimits{
+		limiter:      limiter,
+		keyLimit:     envLimit("RATE_LIMIT_KEY", "600/m"),
+		accountLimit: envLimit("RATE_LIMIT_ACCOUNT", "1200/m"),
+		keyQuota:     envBytes("QUOTA_KEY_BYTES_PER_DAY"),
+		accountQuota: envBytes("QUOTA_ACCOUNT_BYTES_PER_DAY"),
+	}
+}
+
+// Callers limits the caller AuthMiddleware authenticated, and tracks the
+// warehouse bytes of the request for the quotas. It runs after
+// AuthMiddleware.
+func (r *RateLimits) Callers() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			return c.Next()
+		}
+		subject := "key:" + callerID(c, principal)
+		if allowed, err := r.limit(c, subject, r.keyLimit, r.keyQuota); !allowed {
+			return err
+		}
+
+		usage := &db.Usage{}
+		ctx := c.UserContext()
+		c.SetUserContext(db.WithUsage(ctx, usage))
+		err := c.Next()
+		if r.keyQuota > 0 {
+			r.limiter.AddBytes(ctx, subject, ratelimit.Day(time.Now()), usage.Bytes())
+		}
+		return err
+	}
+}
+
+// Accounts limits the account EnforceRBAC scoped the request to, so only
+// requests the caller may make for an account count against it. It runs
+// after EnforceRBAC, on the routes that read accounts.
+func (r *RateLimits) Accounts() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		account, _ := c.Locals("account_id").(string)
+		if account == "" {
+			return c.Next()
+		}
+		subject := "account:" + account
+		if allowed, err := r.limit(c, subject, r.accountLimit, r.accountQuota); !allowed {
+			return err
+		}
+
+		err := c.Next()
+		if usage, ok := db.UsageFrom(c.UserContext()); ok && r.accountQuota > 0 {
+			r.limiter.AddBytes(c.UserContext(), subject, ratelimit.Day(time.Now()), usage.Bytes())
+		}
+		return err
+	}
+}
+
+// limit refuses the request with a 429 when subject used up its quota or
+// its bucket is empty. Otherwise it takes a token and sets the rate limit
+// headers, unless a tighter bucket already set them.
+func (r *RateLimits) limit(c *fiber.Ctx, subject string, limit ratelimit.Limit, quota int64) (bool, error) {
+	ctx := c.UserContext()
+	now := time.Now()
+	if quota > 0 && r.limiter.UsedBytes(ctx, subject, ratelimit.Day(now)) >= quota {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		c.Set(fiber.HeaderRetryAfter, seconds(midnight.Sub(now)))
+		return false, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   "quota_exceeded",
+			"message": fmt.Sprintf("daily quota of %d warehouse bytes used up for %s", quota, subject),
+		})
+	}
+	if !limit.Enabled() {
+		return true, nil
+	}
+
+	result := r.limiter.Take(ctx, subject, limit)
+	if !result.Allowed {
+		setRateLimitHeaders(c, result)
+		c.Set(fiber.HeaderRetryAfter, seconds(result.RetryAfter))
+		return false, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   "rate_limited",
+			"message": fmt.Sprintf("rate limit of %s exceeded for %s", limit, subject),
+		})
+	}
+	if remaining, err := strconv.Atoi(c.GetRespHeader("X-RateLimit-Remaining")); err != nil || result.Remaining < remaining {
+		setRateLimitHeaders(c, result)
+	}
+	return true, nil
+}
+
+// callerID names the bucket of a caller: its principal, or its address when
+// it is anonymous.
+func callerID(c *fiber.Ctx, principal *Principal) string {
+	if principal.ID == anonymousID {
+		return anonymousID + ":" + c.IP()
+	}
+	return principal.ID
+}
+
+func setRateLimitHeaders(c *fiber.Ctx, result ratelimit.Result) {
+	c.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Set("X-RateLimit-Reset", seconds(result.Reset))
+}
+
+// seconds rounds a wait up to whole seconds, as the headers carry them.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func envLimit(name, fallback string) ratelimit.Limit {
+	raw := os.Getenv(name)
+	if raw == "" {
+		raw = fallback
+	}
+	limit, err := ratelimit.ParseLimit(raw)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %v", name, err))
+	}
+	return limit
+}
+
+func envBytes(name string) int64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		panic(fmt.Sprintf("%s: must be a number of bytes, got %q", name, raw))
+	}
+	return n
+}
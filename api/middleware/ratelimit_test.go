@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/ratelimit"
+)
+
+const rateLimitPolicy = `
+roles:
+  viewer:
+    families: [general, revenue]
+default_roles: [viewer]
+principals:
+  - id: victim
+    roles: [viewer]
+    accounts: [acct_001]
+    api_keys: [k_victim]
+  - id: attacker
+    roles: [viewer]
+    accounts: [acct_002]
+    api_keys: [k_attacker]
+`
+
+func TestAccountLimitChargesOnlyAuthorizedRequests(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "")
+	t.Setenv("RATE_LIMIT_KEY", "off")
+	t.Setenv("RATE_LIMIT_ACCOUNT", "2/h")
+	policy := parsePolicy(t, rateLimitPolicy)
+	limits := NewRateLimits(ratelimit.NewLimiter(nil))
+
+	app := fiber.New()
+	app.Use(AuthMiddleware(policy, nil, nil), limits.Callers())
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Get("/metrics", EnforceRBAC(Family("revenue")), limits.Accounts(), ok)
+	app.Get("/accounts/:account_id", EnforceRBAC(Family("general")), limits.Accounts(), ok)
+
+	steps := []struct {
+		name   string
+		key    string
+		path   string
+		status int
+	}{
+		{name: "refused query", key: "k_attacker", path: "/metrics?account_id=acct_001", status: 403},
+		{name: "refused path", key: "k_attacker", path: "/accounts/acct_001", status: 403},
+		{name: "refused again", key: "k_attacker", path: "/metrics?account_id=acct_001", status: 403},
+		{name: "victim first", key: "k_victim", path: "/metrics", status: 200},
+		{name: "victim by path", key: "k_victim", path: "/accounts/acct_001", status: 200},
+		{name: "victim bucket empty", key: "k_victim", path: "/metrics?account_id=acct_001", status: 429},
+		{name: "attacker own account", key: "k_attacker", path: "/metrics", status: 200},
+	}
+	for _, step := range steps {
+		status, body := get(t, app, step.path, step.key)
+		if status != step.status {
+			t.Fatalf("%s: status = %d, want %d (%s)", step.name, status, step.status, body)
+		}
+	}
+}
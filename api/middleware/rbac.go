@@ -1,6 +1,110 @@
 package middleware
 
-func EnforceRBAC(userID string, accountID string) bool {
-	// TODO: Implement RBAC checks
-	return true
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"revenue-dashboard-api/metrics"
+)
+
+// Families resolves the metric families a route reads.
+type Families func(c *fiber.Ctx) []string
+
+// Family is a route that always reads the named families.
+func Family(names ...string) Families {
+	return func(c *fiber.Ctx) []string {
+		return names
+	}
+}
+
+// MetricFamily is a route that reads the registry metric named by its :name
+// parameter. Unknown metrics need no family; the handler reports them.
+func MetricFamily(registry *metrics.Registry) Families {
+	return func(c *fiber.Ctx) []string {
+		return NamedMetricFamily(registry, c.Params("name"))(c)
+	}
+}
+
+// NamedMetricFamily is a route that reads one fixed registry metric.
+func NamedMetricFamily(registry *metrics.Registry, name string) Families {
+	return func(c *fiber.Ctx) []string {
+		metric, ok := registry.Get(name)
+		if !ok {
+			return nil
+		}
+		return []string{metric.Family}
+	}
+}
+
+// EnforceRBAC authorizes a request for the principal AuthMiddleware
+// authenticated: its roles must grant every family the route reads, and the
+// account it asks for (the :account_id parameter or the account_id query)
+// must be one of its accounts. A principal with one account is scoped to it;
+// one with several must say which, and one with none is refused. The
+// account the request is scoped to is left in the account_id local.
+func EnforceRBAC(families Families) fiber.Handler {
+	return enforceRBAC(families, false)
+}
+
+// EnforceRBACListing is EnforceRBAC for routes that list accounts: a
+// principal with several accounts need not name one, and the route lists
+// those AccountScope returns.
+func EnforceRBACListing(families Families) fiber.Handler {
+	return enforceRBAC(families, true)
+}
+
+// AccountScope returns the accounts EnforceRBACListing limited a request
+// to, or nil when it is scoped to one account or may read them all.
+func AccountScope(c *fiber.Ctx) []string {
+	accounts, _ := c.Locals(accountScopeKey).([]string)
+	return accounts
+}
+
+const accountScopeKey = "account_scope"
+
+func enforceRBAC(families Families, listing bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "unauthorized",
+			})
+		}
+
+		for _, family := range families(c) {
+			if !principal.Can(family) {
+				return forbidden(c, "roles "+strings.Join(principal.Roles, ", ")+" do not grant "+family+" metrics")
+			}
+		}
+
+		requested := c.Params("account_id")
+		if requested == "" {
+			requested = c.Query("account_id")
+		}
+		switch {
+		case requested != "":
+			if !principal.HasAccount(requested) {
+				return forbidden(c, "no access to account "+requested)
+			}
+			c.Locals("account_id", requested)
+		case principal.AllAccounts():
+		case len(principal.Accounts) == 0:
+			return forbidden(c, "the caller has no accounts")
+		case len(principal.Accounts) == 1:
+			c.Locals("account_id", principal.Accounts[0])
+		case listing:
+			c.Locals(accountScopeKey, principal.Accounts)
+		default:
+			return forbidden(c, "account_id is required: the caller has access to several accounts")
+		}
+		return c.Next()
+	}
+}
+
+func forbidden(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":   "forbidden",
+		"message": message,
+	})
 }
@@ -0,0 +1,257 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Limit is a token bucket: it holds up to Requests tokens and refills
+// Requests tokens every Period, so bursts of Requests are allowed but the
+// sustained rate is Requests per Period. The zero Limit is off.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+var ErrInvalidLimit = errors.New("limit must look like 120/m (per s, m, h or d) or off")
+
+var periods = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
+
+// ParseLimit reads limits such as "120/m". "off" and "0" disable the limit.
+func ParseLimit(raw string) (Limit, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "off" || raw == "0" {
+		return Limit{}, nil
+	}
+	count, unit, ok := strings.Cut(raw, "/")
+	requests, err := strconv.Atoi(count)
+	if !ok || err != nil || requests < 0 || periods[unit] == 0 {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, raw)
+	}
+	return Limit{Requests: requests, Period: periods[unit]}, nil
+}
+
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	for unit, period := range periods {
+		if period == l.Period {
+			return strconv.Itoa(l.Requests) + "/" + unit
+		}
+	}
+	return strconv.Itoa(l.Requests) + "/" + l.Period.String()
+}
+
+// perMillisecond is the refill rate in tokens per millisecond.
+func (l Limit) perMillisecond() float64 {
+	return float64(l.Requests) / float64(l.Period.Milliseconds())
+}
+
+// Result is the outcome of taking a token. Reset is how long the bucket
+// takes to fill up again; RetryAfter, set when the request was refused, how
+// long until the next token.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// takeScript refills and takes from a bucket atomically, on Redis time so
+// every API instance agrees on it. The bucket expires once it would be full
+// again, since a missing bucket reads as full.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or capacity
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Limiter keeps token buckets and daily byte counters in Redis, so limits
+// hold across API instances, and falls back to memory, per instance, while
+// Redis is unavailable.
+type Limiter struct {
+	redis *redis.Client
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	bytes    map[string]int64
+	day      string
+	warnedAt time.Time
+}
+
+// maxBuckets bounds the in-memory buckets; past it, full buckets, which
+// read the same as missing ones, are dropped.
+const maxBuckets = 10000
+
+// fallbackWarning is how often falling back to memory is logged.
+const fallbackWarning = time.Minute
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+func NewLimiter(client *redis.Client) *Limiter {
+	return &Limiter{redis: client, buckets: map[string]*bucket{}, bytes: map[string]int64{}}
+}
+
+// Take takes a token from the bucket named key.
+func (l *Limiter) Take(ctx context.Context, key string, limit Limit) Result {
+	tokens, allowed, err := l.takeRedis(ctx, key, limit)
+	if err != nil {
+		l.fallback(err)
+		tokens, allowed = l.takeMemory(key, limit)
+	}
+
+	rate := limit.perMillisecond()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration(math.Ceil((float64(limit.Requests)-tokens)/rate)) * time.Millisecond,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+	return result
+}
+
+func (l *Limiter) takeRedis(ctx context.Context, key string, limit Limit) (float64, bool, error) {
+	if l.redis == nil {
+		return 0, false, errors.New("no redis client")
+	}
+	reply, err := takeScript.Run(ctx, l.redis, []string{"ratelimit:" + key}, limit.Requests, limit.perMillisecond()).Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	if len(reply) != 2 {
+		return 0, false, fmt.Errorf("unexpected reply %v", reply)
+	}
+	allowed, _ := reply[0].(int64)
+	raw, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return tokens, allowed == 1, nil
+}
+
+func (l *Limiter) takeMemory(key string, limit Limit) (float64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	capacity := float64(limit.Requests)
+	if len(l.buckets) >= maxBuckets {
+		for name, b := range l.buckets {
+			if now.Sub(b.at) >= limit.Period {
+				delete(l.buckets, name)
+			}
+		}
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, at: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.at).Milliseconds())*limit.perMillisecond())
+	b.at = now
+	if b.tokens < 1 {
+		return b.tokens, false
+	}
+	b.tokens--
+	return b.tokens, true
+}
+
+func (l *Limiter) fallback(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.warnedAt) >= fallbackWarning {
+		l.warnedAt = time.Now()
+		log.Printf("rate limit: redis unavailable, limiting in memory: %v", err)
+	}
+}
+
+// bytesTTL keeps a day's counter a little past the day, for clock skew.
+const bytesTTL = 48 * time.Hour
+
+// Day names the UTC day byte counters are kept per.
+func Day(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// UsedBytes returns the bytes counted against key on day.
+func (l *Limiter) UsedBytes(ctx context.Context, key, day string) int64 {
+	if l.redis != nil {
+		used, err := l.redis.Get(ctx, bytesKey(key, day)).Int64()
+		if err == nil || errors.Is(err, redis.Nil) {
+			return used
+		}
+		l.fallback(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.day != day {
+		return 0
+	}
+	return l.bytes[key]
+}
+
+// AddBytes counts n bytes against key on day.
+func (l *Limiter) AddBytes(ctx context.Context, key, day string, n int64) {
+	if n <= 0 {
+		return
+	}
+	if l.redis != nil {
+		pipe := l.redis.TxPipeline()
+		pipe.IncrBy(ctx, bytesKey(key, day), n)
+		pipe.Expire(ctx, bytesKey(key, day), bytesTTL)
+		_, err := pipe.Exec(ctx)
+		if err == nil {
+			return
+		}
+		l.fallback(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.day != day {
+		l.day, l.bytes = day, map[string]int64{}
+	}
+	l.bytes[key] += n
+}
+
+func bytesKey(key, day string) string {
+	return "quota:bytes:" + key + ":" + day
+}
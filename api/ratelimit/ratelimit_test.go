@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Limit
+		err  bool
+	}{
+		{raw: "120/m", want: Limit{Requests: 120, Period: time.Minute}},
+		{raw: " 5/s ", want: Limit{Requests: 5, Period: time.Second}},
+		{raw: "1000/d", want: Limit{Requests: 1000, Period: 24 * time.Hour}},
+		{raw: "off"},
+		{raw: "0"},
+		{raw: "120", err: true},
+		{raw: "120/w", err: true},
+		{raw: "-1/m", err: true},
+		{raw: "many/m", err: true},
+		{raw: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseLimit(tt.raw)
+			if tt.err {
+				if !errors.Is(err, ErrInvalidLimit) {
+					t.Fatalf("err = %v, want %v", err, ErrInvalidLimit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTakeInMemory(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(nil)
+	limit := Limit{Requests: 3, Period: time.Hour}
+
+	tests := []struct {
+		name      string
+		key       string
+		allowed   bool
+		remaining int
+	}{
+		{name: "first", key: "key:a", allowed: true, remaining: 2},
+		{name: "second", key: "key:a", allowed: true, remaining: 1},
+		{name: "third", key: "key:a", allowed: true, remaining: 0},
+		{name: "bucket empty", key: "key:a", allowed: false, remaining: 0},
+		{name: "other bucket unaffected", key: "key:b", allowed: true, remaining: 2},
+	}
+	for _, tt := range tests {
+		result := limiter.Take(ctx, tt.key, limit)
+		if result.Allowed != tt.allowed || result.Remaining != tt.remaining || result.Limit != 3 {
+			t.Fatalf("%s: Take = %+v, want allowed %v with %d remaining", tt.name, result, tt.allowed, tt.remaining)
+		}
+		if !result.Allowed && (result.RetryAfter <= 0 || result.RetryAfter > limit.Period/3) {
+			t.Errorf("%s: RetryAfter = %v, want at most one token's refill", tt.name, result.RetryAfter)
+		}
+		if result.Allowed && result.RetryAfter != 0 {
+			t.Errorf("%s: RetryAfter = %v on an allowed request", tt.name, result.RetryAfter)
+		}
+	}
+}
+
+func TestTakeRefills(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(nil)
+	limit := Limit{Requests: 1, Period: 50 * time.Millisecond}
+
+	if !limiter.Take(ctx, "key:a", limit).Allowed {
+		t.Fatal("first request refused")
+	}
+	if limiter.Take(ctx, "key:a", limit).Allowed {
+		t.Fatal("second request allowed before the bucket refilled")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !limiter.Take(ctx, "key:a", limit).Allowed {
+		t.Fatal("request refused after the bucket refilled")
+	}
+}
+
+func TestBytesInMemory(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(nil)
+	today, tomorrow := "2026-10-17", "2026-10-18"
+
+	steps := []struct {
+		name string
+		key  string
+		day  string
+		add  int64
+		want int64
+	}{
+		{name: "nothing used", key: "key:a", day: today, want: 0},
+		{name: "adds up", key: "key:a", day: today, add: 100, want: 100},
+		{name: "adds up again", key: "key:a", day: today, add: 50, want: 150},
+		{name: "negative ignored", key: "key:a", day: today, add: -10, want: 150},
+		{name: "per key", key: "account:acct_001", day: today, add: 7, want: 7},
+		{name: "next day starts over", key: "key:a", day: tomorrow, add: 1, want: 1},
+		{name: "previous day dropped", key: "key:a", day: today, want: 0},
+	}
+	for _, step := range steps {
+		limiter.AddBytes(ctx, step.key, step.day, step.add)
+		if got := limiter.UsedBytes(ctx, step.key, step.day); got != step.want {
+			t.Fatalf("%s: UsedBytes = %d, want %d", step.name, got, step.want)
+		}
+	}
+}
+
+func TestLimitString(t *testing.T) {
+	tests := []struct {
+		limit Limit
+		want  string
+	}{
+		{limit: Limit{Requests: 120, Period: time.Minute}, want: "120/m"},
+		{limit: Limit{}, want: "off"},
+		{limit: Limit{Requests: 3, Period: 90 * time.Second}, want: "3/1m30s"},
+	}
+	for _, tt := range tests {
+		if got := tt.limit.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+// Leaderboard sort orders.
+const (
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+var (
+	ErrUnknownAccountSort = errors.New("sort must be revenue, mrr, mrr_change, active_users, last_order_date or account_name")
+	ErrUnknownOrder       = errors.New("order must be asc or desc")
+	ErrUnknownAccount     = errors.New("unknown account")
+	ErrHiddenAccountSort  = errors.New("sort column is not readable by the caller")
+)
+
+// accountSorts are the leaderboard columns accounts can be sorted by, with
+// the metric family a caller must read to see each; revenue columns are
+// always visible.
+var accountSorts = map[string]string{
+	"revenue":         "revenue",
+	"mrr":             "subscription",
+	"mrr_change":      "subscription",
+	"active_users":    "engagement",
+	"last_order_date": "revenue",
+	"account_name":    "revenue",
+}
+
+// accountColumns are the dim_account attributes the leaderboard can be
+// filtered on.
+var accountColumns = map[string]bool{
+	"account_id":     true,
+	"account_name":   true,
+	"industry":       true,
+	"plan_type":      true,
+	"sales_region":   true,
+	"account_status": true,
+}
+
+// AccountSummary is one account's leaderboard row. Revenue and ActiveUsers
+// cover the window; MRR is the snapshot on its last day and MRRChange the
+// difference from the snapshot on its first day; both are left out for
+// callers without the subscription family, and ActiveUsers for those without
+// engagement. LastOrderDate is the account's latest order up to the end of
+// the window.
+type AccountSummary struct {
+	AccountID     string   `json:"account_id"`
+	AccountName   string   `json:"account_name"`
+	Industry      string   `json:"industry,omitempty"`
+	PlanType      string   `json:"plan_type,omitempty"`
+	SalesRegion   string   `json:"sales_region,omitempty"`
+	AccountStatus string   `json:"account_status,omitempty"`
+	Revenue       float64  `json:"revenue"`
+	MRR           *float64 `json:"mrr,omitempty"`
+	MRRChange     *float64 `json:"mrr_change,omitempty"`
+	LastOrderDate *string  `json:"last_order_date"`
+	ActiveUsers   *int     `json:"active_users,omitempty"`
+}
+
+// AccountPage is one page of the leaderboard. Total counts every account
+// matching the filters.
+type AccountPage struct {
+	Sort     string           `json:"sort"`
+	Order    string           `json:"order"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+	Total    int              `json:"total"`
+	Accounts []AccountSummary `json:"accounts"`
+}
+
+// AccountMetric is one registry metric evaluated for a single account.
+type AccountMetric struct {
+	Metric   string  `json:"metric"`
+	Value    float64 `json:"value"`
+	Unit     string  `json:"unit,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+// AccountDetail is an account's leaderboard row with every metric of the
+// semantic layer evaluated for it.
+type AccountDetail struct {
+	Account AccountSummary  `json:"account"`
+	Metrics []AccountMetric `json:"metrics"`
+}
+
+// GetAccounts lists the accounts in dim_account matching the request
+// filters, which may only name dim_account attributes, sorted by sortBy and
+// paged. Accounts without activity in the window are listed with zeros.
+// When accounts is set, only those are listed. MRR and active users are only
+// reported, and sortable, when visible grants their family.
+func GetAccounts(ctx context.Context, warehouse db.Warehouse, sortBy, order string, page, pageSize int, accounts []string, visible func(family string) bool, p metrics.Params) (AccountPage, error) {
+	family, ok := accountSorts[sortBy]
+	if !ok {
+		return AccountPage{}, fmt.Errorf("%w: %s", ErrUnknownAccountSort, sortBy)
+	}
+	if family != "revenue" && !visible(family) {
+		return AccountPage{}, fmt.Errorf("%w: %s needs the %s family", ErrHiddenAccountSort, sortBy, family)
+	}
+	if order != SortAscending && order != SortDescending {
+		return AccountPage{}, fmt.Errorf("%w: %s", ErrUnknownOrder, order)
+	}
+	for _, f := range p.Filters {
+		if !accountColumns[f.Column] {
+			return AccountPage{}, fmt.Errorf("%w: accounts can only be filtered on dim_account attributes, not %s", metrics.ErrInvalidFilter, f.Column)
+		}
+	}
+	if err := checkOrderRates(ctx, warehouse, p.StartDate, p.EndDate); err != nil {
+		return AccountPage{}, err
+	}
+	dialect := warehouse.Dialect()
+
+	b := db.NewBuilder(dialect)
+	countRows, err := warehouse.Query(ctx, "select count(*) as total"+accountsFrom(b, accounts, p), b.Args()...)
+	if err != nil {
+		return AccountPage{}, fmt.Errorf("accounts: %w", err)
+	}
+
+	b = db.NewBuilder(dialect)
+	query := "select * from (select a.account_id as account_id, a.account_name as account_name, a.industry as industry," +
+		" a.plan_type as plan_type, a.sales_region as sales_region, a.account_status as account_status," +
+		" coalesce(o.revenue, 0) as revenue, o.last_order_date as last_order_date," +
+		" coalesce(m_end.mrr, 0) as mrr, coalesce(m_end.mrr, 0) - coalesce(m_start.mrr, 0) as mrr_change," +
+		" coalesce(u.active_users, 0) as active_users" +
+		accountsFrom(b, accounts, p) + ") l" +
+		" order by case when l." + sortBy + " is null then 1 else 0 end, l." + sortBy + " " + order + ", l.account_id" +
+		" limit " + b.Arg(pageSize) + " offset " + b.Arg((page-1)*pageSize)
+	rows, err := warehouse.Query(ctx, query, b.Args()...)
+	if err != nil {
+		return AccountPage{}, fmt.Errorf("accounts: %w", err)
+	}
+
+	result := AccountPage{Sort: sortBy, Order: order, Page: page, PageSize: pageSize, Accounts: make([]AccountSummary, 0, len(rows))}
+	if len(countRows) > 0 {
+		result.Total = countRows[0].Int("total")
+	}
+	for _, row := range rows {
+		account := AccountSummary{
+			AccountID:     row.String("account_id"),
+			AccountName:   row.String("account_name"),
+			Industry:      row.String("industry"),
+			PlanType:      row.String("plan_type"),
+			SalesRegion:   row.String("sales_region"),
+			AccountStatus: row.String("account_status"),
+			Revenue:       roundTo(row.Float("revenue"), 2),
+		}
+		if visible("subscription") {
+			mrr, change := roundTo(row.Float("mrr"), 2), roundTo(row.Float("mrr_change"), 2)
+			account.MRR, account.MRRChange = &mrr, &change
+		}
+		if visible("engagement") {
+			activeUsers := row.Int("active_users")
+			account.ActiveUsers = &activeUsers
+		}
+		if row["last_order_date"] != nil {
+			date := row.Date("last_order_date")
+			account.LastOrderDate = &date
+		}
+		result.Accounts = append(result.Accounts, account)
+	}
+	return result, nil
+}
+
+// accountsFrom joins each account to its per-account aggregates for the
+// window and applies the account scope and filters.
+func accountsFrom(b *db.Builder, accounts []string, p metrics.Params) string {
+	dialect := b.Dialect()
+	snapshot := func(alias, date string) string {
+		return " left join (select account_id, sum(mrr) as mrr from " + dialect.Table("fact_mrr_snapshots") +
+			" where snapshot_date = " + b.DateArg(date) + " group by account_id) " + alias + " on " + alias + ".account_id = a.account_id"
+	}
+
+	// Revenue converts to USD at order-date rates, as the revenue metric does.
+	amount, rates := orderAmount(dialect, "f")
+	clause := " from " + dialect.Table("dim_account") + " a" +
+		" left join (select f.account_id as account_id," +
+		" sum(case when f.order_date >= " + b.DateArg(p.StartDate) + " then " + amount + " else 0 end) as revenue," +
+		" max(f.order_date) as last_order_date" +
+		" from " + dialect.Table("fact_orders") + " f" + rates + " where f.order_date <= " + b.DateArg(p.EndDate) +
+		" group by f.account_id) o on o.account_id = a.account_id" +
+		snapshot("m_end", p.EndDate) +
+		snapshot("m_start", p.StartDate) +
+		" left join (select account_id, count(distinct user_id) as active_users from " + dialect.Table("fact_active_users") +
+		" where activity_date between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate) +
+		" group by account_id) u on u.account_id = a.account_id"
+
+	var conditions []string
+	if p.AccountID != "" {
+		conditions = append(conditions, "a.account_id = "+b.Arg(p.AccountID))
+	}
+	if len(accounts) > 0 {
+		args := make([]string, len(accounts))
+		for i, account := range accounts {
+			args[i] = b.Arg(account)
+		}
+		conditions = append(conditions, "a.account_id in ("+strings.Join(args, ", ")+")")
+	}
+	for _, f := range p.Filters {
+		conditions = append(conditions, metrics.Condition(b, "a."+f.Column, f))
+	}
+	if len(conditions) > 0 {
+		clause += " where " + strings.Join(conditions, " and ")
+	}
+	return clause
+}
+
+// GetAccountDetail returns an account's leaderboard row and the registry
+// metrics of the families visible reports, scoped to the account.
+func GetAccountDetail(ctx context.Context, registry *metrics.Registry, warehouse db.Warehouse, accountID string, visible func(family string) bool, p metrics.Params) (AccountDetail, error) {
+	p.AccountID = accountID
+	p.Filters = nil
+	page, err := GetAccounts(ctx, warehouse, "revenue", SortDescending, 1, 1, nil, visible, p)
+	if err != nil {
+		return AccountDetail{}, err
+	}
+	if len(page.Accounts) == 0 {
+		return AccountDetail{}, fmt.Errorf("%w: %s", ErrUnknownAccount, accountID)
+	}
+
+	result := AccountDetail{Account: page.Accounts[0], Metrics: []AccountMetric{}}
+	for _, name := range registry.Names() {
+		if metric, _ := registry.Get(name); !visible(metric.Family) {
+			continue
+		}
+		value, err := registry.Evaluate(ctx, warehouse, name, p)
+		if err != nil {
+			return AccountDetail{}, err
+		}
+		result.Metrics = append(result.Metrics, AccountMetric{
+			Metric:   name,
+			Value:    value.Value,
+			Unit:     value.Unit,
+			Currency: value.Currency,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package reports_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+// day is the date offset days from today, the day the fixture's facts are
+// seeded back from.
+func day(offset int) string {
+	return time.Now().UTC().AddDate(0, 0, offset).Format("2006-01-02")
+}
+
+func allFamilies(string) bool { return true }
+
+func TestAccountsLeaderboard(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	p := metrics.Params{StartDate: day(-9), EndDate: day(0)}
+
+	page, err := reports.GetAccounts(ctx, warehouse, "revenue", reports.SortDescending, 1, 2, nil, allFamilies, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || len(page.Accounts) != 2 {
+		t.Fatalf("total %d with %d accounts, want 3 with 2", page.Total, len(page.Accounts))
+	}
+	acme := page.Accounts[0]
+	if acme.AccountID != "acct_001" || acme.Revenue != 11125 {
+		t.Errorf("first account %s with revenue %v, want acct_001 with 11125", acme.AccountID, acme.Revenue)
+	}
+	if acme.MRR == nil || *acme.MRR != 2800 || acme.MRRChange == nil || *acme.MRRChange != 90 {
+		t.Errorf("mrr %v, change %v, want 2800 and 90", acme.MRR, acme.MRRChange)
+	}
+	if acme.ActiveUsers == nil || *acme.ActiveUsers != 20 {
+		t.Errorf("active users %v, want 20", acme.ActiveUsers)
+	}
+	if acme.LastOrderDate == nil || *acme.LastOrderDate != day(0) {
+		t.Errorf("last order %v, want %s", acme.LastOrderDate, day(0))
+	}
+	other := page.Accounts[1]
+	if other.Revenue != 0 || other.LastOrderDate != nil || other.MRR == nil || *other.MRR != 0 {
+		t.Errorf("account without activity: %+v", other)
+	}
+
+	tests := []struct {
+		name     string
+		sort     string
+		order    string
+		filters  string
+		accounts []string
+		want     []string
+	}{
+		{name: "by name", sort: "account_name", order: reports.SortAscending, want: []string{"acct_001", "acct_002", "acct_003"}},
+		{name: "by name descending", sort: "account_name", order: reports.SortDescending, want: []string{"acct_003", "acct_002", "acct_001"}},
+		{name: "by mrr change", sort: "mrr_change", order: reports.SortDescending, want: []string{"acct_001", "acct_002", "acct_003"}},
+		{name: "filtered", sort: "revenue", order: reports.SortDescending, filters: "plan_type:in:growth|starter", want: []string{"acct_002", "acct_003"}},
+		{name: "scoped", sort: "account_name", order: reports.SortAscending, accounts: []string{"acct_003", "acct_001"}, want: []string{"acct_001", "acct_003"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := metrics.ParseFilters(tt.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := p
+			p.Filters = filters
+			page, err := reports.GetAccounts(ctx, warehouse, tt.sort, tt.order, 1, 10, tt.accounts, allFamilies, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(page.Accounts))
+			for i, account := range page.Accounts {
+				got[i] = account.AccountID
+			}
+			if page.Total != len(tt.want) || len(got) != len(tt.want) {
+				t.Fatalf("accounts %v (total %d), want %v", got, page.Total, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("accounts %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestAccountsErrors(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	revenueOnly := func(family string) bool { return family == "revenue" }
+
+	tests := []struct {
+		name    string
+		sort    string
+		order   string
+		filters []metrics.Filter
+		want    error
+	}{
+		{name: "unknown sort", sort: "profit", order: reports.SortDescending, want: reports.ErrUnknownAccountSort},
+		{name: "unknown order", sort: "revenue", order: "up", want: reports.ErrUnknownOrder},
+		{name: "hidden sort", sort: "mrr", order: reports.SortDescending, want: reports.ErrHiddenAccountSort},
+		{name: "filter outside dim_account", sort: "revenue", order: reports.SortDescending, filters: []metrics.Filter{{Column: "country_code", Op: "eq", Value: "US"}}, want: metrics.ErrInvalidFilter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := metrics.Params{StartDate: day(-9), EndDate: day(0), Filters: tt.filters}
+			if _, err := reports.GetAccounts(ctx, warehouse, tt.sort, tt.order, 1, 10, nil, revenueOnly, p); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
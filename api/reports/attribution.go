@@ -0,0 +1,291 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+// Attribution models.
+const (
+	ModelFirstTouch = "first_touch"
+	ModelLastTouch  = "last_touch"
+	ModelLinear     = "linear"
+	ModelTimeDecay  = "time_decay"
+)
+
+// timeDecayHalfLife is how long before an order a touch loses half its
+// weight in the time-decay model.
+const timeDecayHalfLife = 7 * 24 * time.Hour
+
+var ErrUnknownModel = errors.New("attribution model must be first_touch, last_touch, linear or time_decay")
+
+// UnattributedChannel is the channel, and channel group, of the orders no
+// session can be credited with.
+const UnattributedChannel = "unattributed"
+
+// ChannelAttribution is what a channel (or channel group) spent and the
+// share of orders credited to it. Conversions and Customers are fractional
+// under the linear and time-decay models. CAC is spend per attributed new
+// customer and ROAS attributed revenue per unit of spend; both are null when
+// their denominator is zero.
+type ChannelAttribution struct {
+	ChannelID    string   `json:"channel_id,omitempty"`
+	Channel      string   `json:"channel,omitempty"`
+	ChannelGroup string   `json:"channel_group"`
+	Spend        float64  `json:"spend"`
+	Revenue      float64  `json:"attributed_revenue"`
+	Conversions  float64  `json:"attributed_conversions"`
+	Customers    float64  `json:"attributed_customers"`
+	CAC          *float64 `json:"cac"`
+	ROAS         *float64 `json:"roas"`
+}
+
+// Attribution credits each order in the window to the channels of the
+// sessions its user had in the lookback window before it. Orders without a
+// user or without such sessions are reported as unattributed, both in the
+// totals and as the UnattributedChannel row, so the channels add up to the
+// window's revenue.
+type Attribution struct {
+	Model                   string               `json:"model"`
+	LookbackDays            int                  `json:"lookback_days"`
+	Channels                []ChannelAttribution `json:"channels"`
+	ChannelGroups           []ChannelAttribution `json:"channel_groups"`
+	UnattributedRevenue     float64              `json:"unattributed_revenue"`
+	UnattributedConversions float64              `json:"unattributed_conversions"`
+}
+
+type touch struct {
+	date    time.Time
+	channel string
+	touches int
+}
+
+func GetAttribution(ctx context.Context, warehouse db.Warehouse, model string, lookbackDays int, p metrics.Params) (Attribution, error) {
+	switch model {
+	case ModelFirstTouch, ModelLastTouch, ModelLinear, ModelTimeDecay:
+	default:
+		return Attribution{}, fmt.Errorf("%w: %s", ErrUnknownModel, model)
+	}
+	start, err := time.Parse("2006-01-02", p.StartDate)
+	if err != nil {
+		return Attribution{}, fmt.Errorf("%w: start_date must be YYYY-MM-DD", metrics.ErrInvalidDateRange)
+	}
+	lookbackStart := db.FormatDate(start.AddDate(0, 0, -lookbackDays))
+	if err := checkOrderRates(ctx, warehouse, p.StartDate, p.EndDate); err != nil {
+		return Attribution{}, err
+	}
+	dialect := warehouse.Dialect()
+	orders := dialect.Table("fact_orders")
+
+	account := func(b *db.Builder, column string) string {
+		if p.AccountID == "" {
+			return ""
+		}
+		return " and " + column + " = " + b.Arg(p.AccountID)
+	}
+
+	b := db.NewBuilder(dialect)
+	amount, rates := orderAmount(dialect, "o")
+	orderQuery := "select o.user_id as user_id, o.order_date as order_date, " + amount + " as amount," +
+		" case when o.order_date = c.acquired then 1 else 0 end as first_order" +
+		" from " + orders + " o left join (select user_id, min(order_date) as acquired from " + orders +
+		" where user_id is not null" + account(b, "account_id") + " group by user_id) c on c.user_id = o.user_id" + rates +
+		" where o.order_date between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate) + account(b, "o.account_id")
+	orderRows, err := warehouse.Query(ctx, orderQuery, b.Args()...)
+	if err != nil {
+		return Attribution{}, fmt.Errorf("attribution orders: %w", err)
+	}
+
+	b = db.NewBuilder(dialect)
+	touchQuery := "select user_id, session_date, channel_id, count(*) as touches from " + dialect.Table("fact_sessions") +
+		" where user_id is not null and channel_id is not null" +
+		" and session_date between " + b.DateArg(lookbackStart) + " and " + b.DateArg(p.EndDate) + account(b, "account_id") +
+		" group by user_id, session_date, channel_id"
+	touchRows, err := warehouse.Query(ctx, touchQuery, b.Args()...)
+	if err != nil {
+		return Attribution{}, fmt.Errorf("attribution sessions: %w", err)
+	}
+
+	b = db.NewBuilder(dialect)
+	spendQuery := "select channel_id, sum(amount) as spend from " + dialect.Table("fact_marketing_spend") +
+		" where spend_date between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate) + account(b, "account_id") +
+		" group by channel_id"
+	spendRows, err := warehouse.Query(ctx, spendQuery, b.Args()...)
+	if err != nil {
+		return Attribution{}, fmt.Errorf("attribution spend: %w", err)
+	}
+
+	channelRows, err := warehouse.Query(ctx, "select channel_id, channel_name, channel_group from "+dialect.Table("dim_channel"))
+	if err != nil {
+		return Attribution{}, fmt.Errorf("attribution channels: %w", err)
+	}
+
+	channels := map[string]*ChannelAttribution{}
+	channel := func(id string) *ChannelAttribution {
+		if channels[id] == nil {
+			channels[id] = &ChannelAttribution{ChannelID: id, Channel: id, ChannelGroup: "unknown"}
+			if id == UnattributedChannel {
+				channels[id].ChannelGroup = UnattributedChannel
+			}
+		}
+		return channels[id]
+	}
+	for _, row := range channelRows {
+		c := channel(row.String("channel_id"))
+		c.Channel = row.String("channel_name")
+		if group := row.String("channel_group"); group != "" {
+			c.ChannelGroup = group
+		}
+	}
+	for _, row := range spendRows {
+		id := row.String("channel_id")
+		if id == "" {
+			id = "unknown"
+		}
+		channel(id).Spend += row.Float("spend")
+	}
+
+	touches := map[string][]touch{}
+	for _, row := range touchRows {
+		date, err := time.Parse("2006-01-02", row.Date("session_date"))
+		if err != nil {
+			return Attribution{}, fmt.Errorf("attribution sessions: %w", err)
+		}
+		user := row.String("user_id")
+		touches[user] = append(touches[user], touch{date: date, channel: row.String("channel_id"), touches: row.Int("touches")})
+	}
+	for _, list := range touches {
+		sort.Slice(list, func(i, j int) bool {
+			if !list[i].date.Equal(list[j].date) {
+				return list[i].date.Before(list[j].date)
+			}
+			return list[i].channel < list[j].channel
+		})
+	}
+
+	result := Attribution{Model: model, LookbackDays: lookbackDays}
+	counted := map[string]bool{}
+	for _, row := range orderRows {
+		user := row.String("user_id")
+		date, err := time.Parse("2006-01-02", row.Date("order_date"))
+		if err != nil {
+			return Attribution{}, fmt.Errorf("attribution orders: %w", err)
+		}
+		revenue := row.Float("amount")
+		newCustomer := row.Int("first_order") == 1 && !counted[user]
+		if newCustomer {
+			counted[user] = true
+		}
+
+		weights := credit(model, touches[user], date, lookbackDays)
+		if len(weights) == 0 {
+			weights = map[string]float64{UnattributedChannel: 1}
+			result.UnattributedRevenue += revenue
+			result.UnattributedConversions++
+		}
+		for id, weight := range weights {
+			c := channel(id)
+			c.Revenue += revenue * weight
+			c.Conversions += weight
+			if newCustomer {
+				c.Customers += weight
+			}
+		}
+	}
+
+	groups := map[string]*ChannelAttribution{}
+	for _, c := range channels {
+		g := groups[c.ChannelGroup]
+		if g == nil {
+			g = &ChannelAttribution{ChannelGroup: c.ChannelGroup}
+			groups[c.ChannelGroup] = g
+		}
+		g.Spend += c.Spend
+		g.Revenue += c.Revenue
+		g.Conversions += c.Conversions
+		g.Customers += c.Customers
+	}
+	result.Channels = finish(channels)
+	result.ChannelGroups = finish(groups)
+	result.UnattributedRevenue = roundTo(result.UnattributedRevenue, 2)
+	return result, nil
+}
+
+// credit splits one order between channels according to model, using the
+// user's touches from lookbackDays before the order date up to that date.
+func credit(model string, touches []touch, orderDate time.Time, lookbackDays int) map[string]float64 {
+	from := orderDate.AddDate(0, 0, -lookbackDays)
+	var eligible []touch
+	for _, t := range touches {
+		if !t.date.Before(from) && !t.date.After(orderDate) {
+			eligible = append(eligible, t)
+		}
+	}
+	if len(eligible) == 0 {
+		return nil
+	}
+
+	weights := map[string]float64{}
+	switch model {
+	case ModelFirstTouch:
+		weights[eligible[0].channel] = 1
+		return weights
+	case ModelLastTouch:
+		weights[eligible[len(eligible)-1].channel] = 1
+		return weights
+	}
+
+	var total float64
+	for _, t := range eligible {
+		weight := float64(t.touches)
+		if model == ModelTimeDecay {
+			weight *= math.Pow(0.5, float64(orderDate.Sub(t.date))/float64(timeDecayHalfLife))
+		}
+		weights[t.channel] += weight
+		total += weight
+	}
+	for id := range weights {
+		weights[id] /= total
+	}
+	return weights
+}
+
+// finish rounds the totals, derives CAC and ROAS and orders rows by
+// attributed revenue.
+func finish(rows map[string]*ChannelAttribution) []ChannelAttribution {
+	result := make([]ChannelAttribution, 0, len(rows))
+	for _, c := range rows {
+		if c.Customers > 0 {
+			cac := roundTo(c.Spend/c.Customers, 2)
+			c.CAC = &cac
+		}
+		if c.Spend > 0 {
+			roas := roundTo(c.Revenue/c.Spend, 4)
+			c.ROAS = &roas
+		}
+		c.Spend = roundTo(c.Spend, 2)
+		c.Revenue = roundTo(c.Revenue, 2)
+		c.Conversions = roundTo(c.Conversions, 4)
+		c.Customers = roundTo(c.Customers, 4)
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Revenue != result[j].Revenue {
+			return result[i].Revenue > result[j].Revenue
+		}
+		return result[i].ChannelGroup+result[i].Channel < result[j].ChannelGroup+result[j].Channel
+	})
+	return result
+}
+
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
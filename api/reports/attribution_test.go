@@ -0,0 +1,121 @@
+package reports_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+// Order -i of the last ten days belongs to user i, whose sessions on day -d
+// come from channel (i+d)%4 of Organic Search, Paid Search, Direct and
+// Email. The last touch is on the order's own day, so even orders go to
+// Organic Search and odd ones to Direct; the first touch in the 30-day
+// lookback is 29 days ago.
+func TestAttribution(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	p := metrics.Params{StartDate: day(-9), EndDate: day(0)}
+
+	tests := []struct {
+		model string
+		want  map[string]float64
+	}{
+		{model: reports.ModelLastTouch, want: map[string]float64{"Organic Search": 5500, "Direct": 5625}},
+		{model: reports.ModelFirstTouch, want: map[string]float64{"Paid Search": 3300, "Direct": 3375, "Email": 2200, "Organic Search": 2250}},
+		{model: reports.ModelLinear},
+		{model: reports.ModelTimeDecay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			got, err := reports.GetAttribution(ctx, warehouse, tt.model, 30, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var revenue, conversions, spend float64
+			for _, c := range got.Channels {
+				revenue += c.Revenue
+				conversions += c.Conversions
+				spend += c.Spend
+				if tt.want != nil && c.Revenue != tt.want[c.Channel] {
+					t.Errorf("%s: %v, want %v", c.Channel, c.Revenue, tt.want[c.Channel])
+				}
+				if c.Customers != 0 || c.CAC != nil {
+					t.Errorf("%s: %v new customers, CAC %v; the fixture's customers all ordered before", c.Channel, c.Customers, c.CAC)
+				}
+			}
+			if math.Abs(revenue+got.UnattributedRevenue-11125) > 0.01 || math.Abs(conversions+got.UnattributedConversions-10) > 0.001 {
+				t.Errorf("revenue %v and %v conversions, want 11125 and 10", revenue+got.UnattributedRevenue, conversions+got.UnattributedConversions)
+			}
+			if got.UnattributedRevenue != 0 {
+				t.Errorf("unattributed revenue %v, want 0", got.UnattributedRevenue)
+			}
+			if spend != 3225 {
+				t.Errorf("spend %v, want 3225", spend)
+			}
+			var groups float64
+			for _, g := range got.ChannelGroups {
+				groups += g.Revenue
+			}
+			if math.Abs(groups-revenue) > 0.01 {
+				t.Errorf("channel groups add up to %v, channels to %v", groups, revenue)
+			}
+		})
+	}
+
+	if _, err := reports.GetAttribution(ctx, warehouse, "u_shaped", 30, p); !errors.Is(err, reports.ErrUnknownModel) {
+		t.Errorf("err = %v, want ErrUnknownModel", err)
+	}
+}
+
+func TestAttributionUnattributed(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+
+	// An order without a user, and the first order of a user without
+	// sessions.
+	insert := `insert into fact_orders (order_id, order_date, account_id, user_id, product_id, net_amount, currency) values (?, ?, 'acct_001', ?, 'prod_001', ?, 'USD')`
+	for _, order := range []struct {
+		id     string
+		user   interface{}
+		amount float64
+	}{
+		{"order_guest", nil, 500},
+		{"order_offline", "user_offline", 250},
+	} {
+		if _, err := warehouse.ExecContext(ctx, insert, order.id, day(-1), order.user, order.amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := reports.GetAttribution(ctx, warehouse, reports.ModelLastTouch, 30, metrics.Params{StartDate: day(-9), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UnattributedRevenue != 750 || got.UnattributedConversions != 2 {
+		t.Errorf("unattributed %v from %v orders, want 750 from 2", got.UnattributedRevenue, got.UnattributedConversions)
+	}
+	var revenue float64
+	var unattributed *reports.ChannelAttribution
+	for i, c := range got.Channels {
+		revenue += c.Revenue
+		if c.ChannelID == reports.UnattributedChannel {
+			unattributed = &got.Channels[i]
+		}
+	}
+	if revenue != 11875 {
+		t.Errorf("channels add up to %v, want 11875", revenue)
+	}
+	if unattributed == nil || unattributed.ChannelGroup != reports.UnattributedChannel || unattributed.Revenue != 750 || unattributed.Conversions != 2 || unattributed.Customers != 1 {
+		t.Errorf("unattributed channel = %+v, want 750 from 2 orders and 1 new customer", unattributed)
+	}
+	for _, g := range got.ChannelGroups {
+		if g.ChannelGroup == reports.UnattributedChannel && g.Revenue != 750 {
+			t.Errorf("unattributed group %v, want 750", g.Revenue)
+		}
+	}
+}
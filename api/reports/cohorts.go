@@ -0,0 +1,122 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+var ErrUnknownPeriod = errors.New("cohort period must be week or month")
+
+// Cohort is one row of a retention matrix. Retained[i] counts the cohort's
+// users active i periods after the period they signed up in (period 0 is the
+// signup period itself) and Retention[i] is that count as a percentage of
+// Users.
+type Cohort struct {
+	Cohort    string    `json:"cohort"`
+	Users     int       `json:"users"`
+	Retained  []int     `json:"retained"`
+	Retention []float64 `json:"retention"`
+}
+
+type CohortRetention struct {
+	Period  string   `json:"period"`
+	Cohorts []Cohort `json:"cohorts"`
+}
+
+// GetCohortRetention groups the users who signed up in the window by signup
+// week (ISO) or month and counts how many were active in each following
+// period, up to periods columns or today, whichever comes first.
+func GetCohortRetention(ctx context.Context, warehouse db.Warehouse, period string, periods int, p metrics.Params) (CohortRetention, error) {
+	if period != db.GranularityWeek && period != db.GranularityMonth {
+		return CohortRetention{}, fmt.Errorf("%w: %s", ErrUnknownPeriod, period)
+	}
+	dialect := warehouse.Dialect()
+	cohort := dialect.DateTrunc("u.signup_ts", period)
+	signupDate := dialect.DateTrunc("u.signup_ts", db.GranularityDay)
+
+	b := db.NewBuilder(dialect)
+	sizeQuery := "select " + cohort + " as cohort, count(*) as users from " + dialect.Table("dim_user") + " u" +
+		" where " + signupDate + " between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate)
+	if p.AccountID != "" {
+		sizeQuery += " and u.account_id = " + b.Arg(p.AccountID)
+	}
+	sizeQuery += " group by " + cohort + " order by " + cohort
+	sizes, err := warehouse.Query(ctx, sizeQuery, b.Args()...)
+	if err != nil {
+		return CohortRetention{}, fmt.Errorf("cohort sizes: %w", err)
+	}
+
+	activity := dialect.DateTrunc("a.activity_date", period)
+	b = db.NewBuilder(dialect)
+	activeQuery := "select " + cohort + " as cohort, " + activity + " as activity, count(distinct a.user_id) as users" +
+		" from " + dialect.Table("fact_active_users") + " a join " + dialect.Table("dim_user") + " u on u.user_id = a.user_id" +
+		" where " + signupDate + " between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate)
+	if p.AccountID != "" {
+		activeQuery += " and a.account_id = " + b.Arg(p.AccountID)
+	}
+	activeQuery += " group by " + cohort + ", " + activity
+	active, err := warehouse.Query(ctx, activeQuery, b.Args()...)
+	if err != nil {
+		return CohortRetention{}, fmt.Errorf("cohort activity: %w", err)
+	}
+
+	retained := map[string]map[int]int{}
+	for _, row := range active {
+		key := row.Date("cohort")
+		offset, err := periodsBetween(key, row.Date("activity"), period)
+		if err != nil || offset < 0 {
+			continue
+		}
+		if retained[key] == nil {
+			retained[key] = map[int]int{}
+		}
+		retained[key][offset] = row.Int("users")
+	}
+
+	today := db.FormatDate(time.Now().UTC())
+	result := CohortRetention{Period: period, Cohorts: make([]Cohort, 0, len(sizes))}
+	for _, row := range sizes {
+		key := row.Date("cohort")
+		elapsed, err := periodsBetween(key, today, period)
+		if err != nil {
+			return CohortRetention{}, fmt.Errorf("cohort %q: %w", key, err)
+		}
+		columns := periods
+		if elapsed+1 < columns {
+			columns = elapsed + 1
+		}
+
+		c := Cohort{Cohort: key, Users: row.Int("users"), Retained: make([]int, columns), Retention: make([]float64, columns)}
+		for i := range c.Retained {
+			c.Retained[i] = retained[key][i]
+			if c.Users > 0 {
+				c.Retention[i] = math.Round(float64(c.Retained[i])/float64(c.Users)*100*100) / 100
+			}
+		}
+		result.Cohorts = append(result.Cohorts, c)
+	}
+	return result, nil
+}
+
+// periodsBetween counts whole weeks or calendar months from one
+// YYYY-MM-DD date to another.
+func periodsBetween(from, to, period string) (int, error) {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return 0, err
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return 0, err
+	}
+	if period == db.GranularityWeek {
+		return int(end.Sub(start).Hours()/24) / 7, nil
+	}
+	return (end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month()), nil
+}
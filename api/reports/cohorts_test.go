@@ -0,0 +1,109 @@
+package reports_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+func TestCohortRetention(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+
+	// Two users sign up in the ISO week of Monday 2025-01-06 and one in the
+	// next, long before the fixture's own users.
+	for _, user := range []struct{ id, signup string }{
+		{"user_c1", "2025-01-06 08:00:00"},
+		{"user_c2", "2025-01-12 23:30:00"},
+		{"user_c3", "2025-01-14 12:00:00"},
+	} {
+		if _, err := warehouse.ExecContext(ctx, `insert into dim_user (user_id, account_id, country_code, user_type, signup_ts) values (?, 'acct_002', 'US', 'member', ?)`, user.id, user.signup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, activity := range []struct{ user, date string }{
+		{"user_c1", "2025-01-07"},
+		{"user_c1", "2025-01-15"},
+		{"user_c1", "2025-01-16"},
+		{"user_c2", "2025-01-22"},
+		{"user_c3", "2025-01-14"},
+		{"user_c3", "2025-01-28"},
+	} {
+		if _, err := warehouse.ExecContext(ctx, `insert into fact_active_users (user_id, activity_date, account_id) values (?, ?, 'acct_002')`, activity.user, activity.date); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		period  string
+		periods int
+		p       metrics.Params
+		want    []reports.Cohort
+	}{
+		{
+			name: "weeks", period: "week", periods: 3, p: metrics.Params{StartDate: "2025-01-01", EndDate: "2025-01-31"},
+			want: []reports.Cohort{
+				{Cohort: "2025-01-06", Users: 2, Retained: []int{1, 1, 1}, Retention: []float64{50, 50, 50}},
+				{Cohort: "2025-01-13", Users: 1, Retained: []int{1, 0, 1}, Retention: []float64{100, 0, 100}},
+			},
+		},
+		{
+			name: "months", period: "month", periods: 2, p: metrics.Params{StartDate: "2025-01-01", EndDate: "2025-01-31"},
+			want: []reports.Cohort{
+				{Cohort: "2025-01-01", Users: 3, Retained: []int{3, 0}, Retention: []float64{100, 0}},
+			},
+		},
+		{
+			name: "signups outside the window", period: "week", periods: 3, p: metrics.Params{StartDate: "2025-01-13", EndDate: "2025-01-19"},
+			want: []reports.Cohort{
+				{Cohort: "2025-01-13", Users: 1, Retained: []int{1, 0, 1}, Retention: []float64{100, 0, 100}},
+			},
+		},
+		{
+			name: "other account", period: "week", periods: 3, p: metrics.Params{StartDate: "2025-01-01", EndDate: "2025-01-31", AccountID: "acct_001"},
+			want: []reports.Cohort{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reports.GetCohortRetention(ctx, warehouse, tt.period, tt.periods, tt.p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Period != tt.period || !reflect.DeepEqual(got.Cohorts, tt.want) {
+				t.Errorf("cohorts = %+v, want %+v", got.Cohorts, tt.want)
+			}
+		})
+	}
+
+	if _, err := reports.GetCohortRetention(ctx, warehouse, "day", 3, tests[0].p); !errors.Is(err, reports.ErrUnknownPeriod) {
+		t.Errorf("err = %v, want ErrUnknownPeriod", err)
+	}
+}
+
+// The latest cohort has only the columns that have begun: the fixture's
+// users signed up weekly from six months ago and were active every day of
+// the last 30.
+func TestCohortRetentionStopsAtToday(t *testing.T) {
+	got, err := reports.GetCohortRetention(context.Background(), sqlitetest.Open(t), "month", 12, metrics.Params{StartDate: day(-200), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := 0
+	for _, cohort := range got.Cohorts {
+		users += cohort.Users
+		last := len(cohort.Retained) - 1
+		if last < 0 || cohort.Retained[last] != cohort.Users {
+			t.Errorf("cohort %s: retained %v of %d users, want all in the current month", cohort.Cohort, cohort.Retained, cohort.Users)
+		}
+	}
+	if users != 20 {
+		t.Errorf("%d users in cohorts, want 20", users)
+	}
+}
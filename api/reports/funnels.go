@@ -0,0 +1,123 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+// FunnelStep reports how many sessions reached a step, as a percentage of
+// the previous step (Conversion) and of the first (OverallConversion), and
+// the median seconds those sessions took from the previous step. The first
+// step has no median.
+type FunnelStep struct {
+	Step              string   `json:"step"`
+	Sessions          int      `json:"sessions"`
+	Conversion        float64  `json:"conversion"`
+	OverallConversion float64  `json:"overall_conversion"`
+	MedianSeconds     *float64 `json:"median_seconds"`
+}
+
+type FunnelResult struct {
+	Funnel string       `json:"funnel"`
+	Window string       `json:"window"`
+	Steps  []FunnelStep `json:"steps"`
+}
+
+// GetFunnel evaluates a funnel over the sessions in the window. Each session
+// is judged on the first time it reached each step: it reaches step k when
+// steps 1..k happened in order and step k within the funnel window of step 1.
+func GetFunnel(ctx context.Context, warehouse db.Warehouse, funnel *metrics.Funnel, p metrics.Params) (FunnelResult, error) {
+	dialect := warehouse.Dialect()
+	b := db.NewBuilder(dialect)
+	placeholders := make([]string, len(funnel.Steps))
+	for i, step := range funnel.Steps {
+		placeholders[i] = b.Arg(step)
+	}
+	query := "select e.session_id as session_id, e.step as step, min(e.event_ts) as first_ts" +
+		" from " + dialect.Table("fact_session_events") + " e join " + dialect.Table("fact_sessions") + " s on s.session_id = e.session_id" +
+		" where e.step in (" + strings.Join(placeholders, ", ") + ")" +
+		" and s.session_date between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate)
+	if p.AccountID != "" {
+		query += " and s.account_id = " + b.Arg(p.AccountID)
+	}
+	query += " group by e.session_id, e.step"
+
+	rows, err := warehouse.Query(ctx, query, b.Args()...)
+	if err != nil {
+		return FunnelResult{}, fmt.Errorf("funnel %s: %w", funnel.Name, err)
+	}
+
+	sessions := map[string]map[string]time.Time{}
+	for _, row := range rows {
+		ts, ok := row.Time("first_ts")
+		if !ok {
+			return FunnelResult{}, fmt.Errorf("funnel %s: unreadable event_ts %v", funnel.Name, row["first_ts"])
+		}
+		id := row.String("session_id")
+		if sessions[id] == nil {
+			sessions[id] = map[string]time.Time{}
+		}
+		sessions[id][row.String("step")] = ts
+	}
+
+	reached := make([]int, len(funnel.Steps))
+	durations := make([][]float64, len(funnel.Steps))
+	for _, steps := range sessions {
+		first, ok := steps[funnel.Steps[0]]
+		if !ok {
+			continue
+		}
+		reached[0]++
+		previous := first
+		for k := 1; k < len(funnel.Steps); k++ {
+			ts, ok := steps[funnel.Steps[k]]
+			if !ok || ts.Before(previous) || ts.Sub(first) > funnel.Window {
+				break
+			}
+			reached[k]++
+			durations[k] = append(durations[k], ts.Sub(previous).Seconds())
+			previous = ts
+		}
+	}
+
+	result := FunnelResult{Funnel: funnel.Name, Window: funnel.Window.String(), Steps: make([]FunnelStep, len(funnel.Steps))}
+	for k, step := range funnel.Steps {
+		s := FunnelStep{Step: step, Sessions: reached[k], MedianSeconds: median(durations[k])}
+		if k == 0 {
+			if reached[0] > 0 {
+				s.Conversion, s.OverallConversion = 100, 100
+			}
+		} else {
+			s.Conversion = percent(reached[k], reached[k-1])
+			s.OverallConversion = percent(reached[k], reached[0])
+		}
+		result.Steps[k] = s
+	}
+	return result, nil
+}
+
+func percent(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*100*100) / 100
+}
+
+func median(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	sort.Float64s(values)
+	m := values[len(values)/2]
+	if len(values)%2 == 0 {
+		m = (values[len(values)/2-1] + m) / 2
+	}
+	return &m
+}
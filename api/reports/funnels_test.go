@@ -0,0 +1,69 @@
+package reports_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+// Of the fixture's 40 sessions a day, 24 view a product, 12 add to cart and
+// 4 purchase. Views come 2 minutes after the visit, carts 3 minutes later
+// and purchases 4 minutes after that, up to 40% slower for later sessions.
+func TestFunnel(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	checkout, ok := metrics.NewRegistry().Funnel("checkout")
+	if !ok {
+		t.Fatal("no checkout funnel")
+	}
+
+	got, err := reports.GetFunnel(ctx, warehouse, checkout, metrics.Params{StartDate: day(-9), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		step              string
+		sessions          int
+		conversion        float64
+		overallConversion float64
+		median            float64
+	}{
+		{step: "visit", sessions: 400, conversion: 100, overallConversion: 100},
+		{step: "product_view", sessions: 240, conversion: 60, overallConversion: 60, median: 138},
+		{step: "add_to_cart", sessions: 120, conversion: 50, overallConversion: 30, median: 198},
+		{step: "purchase", sessions: 40, conversion: 33.33, overallConversion: 10, median: 240},
+	}
+	if got.Window != (24*time.Hour).String() || len(got.Steps) != len(want) {
+		t.Fatalf("funnel = %+v", got)
+	}
+	for i, step := range got.Steps {
+		w := want[i]
+		if step.Step != w.step || step.Sessions != w.sessions || step.Conversion != w.conversion || step.OverallConversion != w.overallConversion {
+			t.Errorf("step %d = %+v, want %+v", i, step, w)
+		}
+		switch {
+		case i == 0 && step.MedianSeconds != nil:
+			t.Errorf("%s has a median %v", step.Step, *step.MedianSeconds)
+		case i > 0 && (step.MedianSeconds == nil || *step.MedianSeconds != w.median):
+			t.Errorf("%s median = %v, want %v", step.Step, step.MedianSeconds, w.median)
+		}
+	}
+
+	// Steps reached after the window do not count.
+	short := *checkout
+	short.Window = 6 * time.Minute
+	got, err = reports.GetFunnel(ctx, warehouse, &short, metrics.Params{StartDate: day(-9), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions := got.Steps[3].Sessions; sessions != 0 {
+		t.Errorf("%d purchases within 6 minutes, want 0", sessions)
+	}
+	if sessions := got.Steps[2].Sessions; sessions != 120 {
+		t.Errorf("%d carts within 6 minutes, want 120", sessions)
+	}
+}
@@ -0,0 +1,239 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+// Curves follow each customer for ltvHorizon days, with a cumulative point
+// every ltvCurveStep days.
+const (
+	ltvHorizon   = 365
+	ltvCurveStep = 30
+)
+
+// LTVMilestones are empirical lifetime values: cumulative revenue per
+// customer within N days of their first order, over the customers whose
+// first order is at least N days old. A milestone no customer has reached
+// yet is null.
+type LTVMilestones struct {
+	Days30  *float64 `json:"ltv_30"`
+	Days90  *float64 `json:"ltv_90"`
+	Days180 *float64 `json:"ltv_180"`
+	Days365 *float64 `json:"ltv_365"`
+}
+
+// LTVCohort is the curve of the customers acquired in one month: Curve[i] is
+// cumulative revenue per customer within 30*(i+1) days of acquisition, for
+// as many points as the cohort has reached.
+type LTVCohort struct {
+	Cohort    string    `json:"cohort"`
+	Customers int       `json:"customers"`
+	Curve     []float64 `json:"curve"`
+	LTVMilestones
+}
+
+// LTVCurves is the cohort method of LTV. ProjectedLTV extends the overall
+// curve assuming revenue per customer keeps decaying month over month at the
+// rate of its last three points; it is null until the curve has three points.
+type LTVCurves struct {
+	Method       string      `json:"method"`
+	Customers    int         `json:"customers"`
+	Curve        []float64   `json:"curve"`
+	ProjectedLTV *float64    `json:"projected_ltv"`
+	Cohorts      []LTVCohort `json:"cohorts"`
+	LTVMilestones
+}
+
+// acquisition is the customers whose first order was on one day: how many,
+// how many days ago, and their revenue by days since that first order.
+type acquisition struct {
+	customers int
+	elapsed   int
+	revenue   map[int]float64
+}
+
+// GetLTVCurves builds cumulative revenue-per-customer curves from
+// fact_orders for the customers (users) whose first order falls in the
+// window, grouped by the month of that first order.
+func GetLTVCurves(ctx context.Context, warehouse db.Warehouse, p metrics.Params) (LTVCurves, error) {
+	// Customers acquired in the window keep ordering after it.
+	if err := checkOrderRates(ctx, warehouse, p.StartDate, ""); err != nil {
+		return LTVCurves{}, err
+	}
+	dialect := warehouse.Dialect()
+	orders := dialect.Table("fact_orders")
+
+	// firstOrders derives each customer's first order date, within the
+	// account when one is given.
+	firstOrders := func(b *db.Builder) string {
+		query := "(select user_id, min(order_date) as acquired from " + orders + " where user_id is not null"
+		if p.AccountID != "" {
+			query += " and account_id = " + b.Arg(p.AccountID)
+		}
+		return query + " group by user_id) c"
+	}
+
+	b := db.NewBuilder(dialect)
+	customerQuery := "select c.acquired as acquired, count(*) as customers from " + firstOrders(b) +
+		" where c.acquired between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate) +
+		" group by c.acquired"
+	customerRows, err := warehouse.Query(ctx, customerQuery, b.Args()...)
+	if err != nil {
+		return LTVCurves{}, fmt.Errorf("ltv customers: %w", err)
+	}
+
+	b = db.NewBuilder(dialect)
+	age := dialect.DaysBetween("c.acquired", "o.order_date")
+	amount, rates := orderAmount(dialect, "o")
+	revenueQuery := "select c.acquired as acquired, " + age + " as age, sum(" + amount + ") as revenue" +
+		" from " + orders + " o join " + firstOrders(b) + " on c.user_id = o.user_id" + rates +
+		" where c.acquired between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate) +
+		" and " + age + " < " + b.Arg(ltvHorizon)
+	if p.AccountID != "" {
+		revenueQuery += " and o.account_id = " + b.Arg(p.AccountID)
+	}
+	revenueQuery += " group by c.acquired, " + age
+	revenueRows, err := warehouse.Query(ctx, revenueQuery, b.Args()...)
+	if err != nil {
+		return LTVCurves{}, fmt.Errorf("ltv revenue: %w", err)
+	}
+
+	today := time.Now().UTC().Format("2006-01-02")
+	acquisitions := map[string]*acquisition{}
+	for _, row := range customerRows {
+		acquired := row.Date("acquired")
+		elapsed, err := daysBetween(acquired, today)
+		if err != nil {
+			return LTVCurves{}, fmt.Errorf("ltv customers: %w", err)
+		}
+		acquisitions[acquired] = &acquisition{customers: row.Int("customers"), elapsed: elapsed, revenue: map[int]float64{}}
+	}
+	for _, row := range revenueRows {
+		if a, ok := acquisitions[row.Date("acquired")]; ok {
+			a.revenue[row.Int("age")] += row.Float("revenue")
+		}
+	}
+
+	var all []*acquisition
+	months := map[string][]*acquisition{}
+	for acquired, a := range acquisitions {
+		all = append(all, a)
+		months[acquired[:8]+"01"] = append(months[acquired[:8]+"01"], a)
+	}
+
+	result := LTVCurves{
+		Method:        "cohort",
+		Customers:     customers(all),
+		Curve:         curve(all),
+		LTVMilestones: milestones(all),
+		Cohorts:       make([]LTVCohort, 0, len(months)),
+	}
+	result.ProjectedLTV = project(result.Curve)
+	for month, group := range months {
+		result.Cohorts = append(result.Cohorts, LTVCohort{
+			Cohort:        month,
+			Customers:     customers(group),
+			Curve:         curve(group),
+			LTVMilestones: milestones(group),
+		})
+	}
+	sort.Slice(result.Cohorts, func(i, j int) bool {
+		return result.Cohorts[i].Cohort < result.Cohorts[j].Cohort
+	})
+	return result, nil
+}
+
+func customers(group []*acquisition) int {
+	n := 0
+	for _, a := range group {
+		n += a.customers
+	}
+	return n
+}
+
+// cumulative is revenue per customer within horizon days of acquisition,
+// over the customers acquired at least horizon days ago.
+func cumulative(group []*acquisition, horizon int) (float64, bool) {
+	var revenue float64
+	var n int
+	for _, a := range group {
+		if a.elapsed < horizon {
+			continue
+		}
+		n += a.customers
+		for age, value := range a.revenue {
+			if age < horizon {
+				revenue += value
+			}
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return math.Round(revenue/float64(n)*100) / 100, true
+}
+
+func curve(group []*acquisition) []float64 {
+	points := []float64{}
+	for horizon := ltvCurveStep; horizon <= ltvHorizon; horizon += ltvCurveStep {
+		value, ok := cumulative(group, horizon)
+		if !ok {
+			break
+		}
+		points = append(points, value)
+	}
+	return points
+}
+
+func milestones(group []*acquisition) LTVMilestones {
+	at := func(horizon int) *float64 {
+		if value, ok := cumulative(group, horizon); ok {
+			return &value
+		}
+		return nil
+	}
+	return LTVMilestones{Days30: at(30), Days90: at(90), Days180: at(180), Days365: at(365)}
+}
+
+// project extends a cumulative curve with a geometric tail: the last monthly
+// increment keeps shrinking by the average ratio between the last three
+// increments, capped below 1 so the sum converges.
+func project(points []float64) *float64 {
+	n := len(points)
+	if n < 3 {
+		return nil
+	}
+	increment := func(i int) float64 {
+		if i == 0 {
+			return points[0]
+		}
+		return points[i] - points[i-1]
+	}
+	last := increment(n - 1)
+	var ratio float64
+	if older := increment(n - 3); older > 0 && last > 0 {
+		ratio = math.Min(math.Sqrt(last/older), 0.95)
+	}
+	projected := math.Round((points[n-1]+last*ratio/(1-ratio))*100) / 100
+	return &projected
+}
+
+// daysBetween counts days from one YYYY-MM-DD date to another.
+func daysBetween(from, to string) (int, error) {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return 0, err
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return 0, err
+	}
+	return int(end.Sub(start).Hours() / 24), nil
+}
@@ -0,0 +1,67 @@
+package reports_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+func TestLTVCurves(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+
+	// Two customers first order 100 and 97 days ago, long before the
+	// fixture's own orders; the first orders again 20 and 80 days later.
+	insert := `insert into fact_orders (order_id, order_date, account_id, user_id, product_id, net_amount, currency) values (?, ?, 'acct_002', ?, 'prod_001', ?, 'USD')`
+	for _, order := range []struct {
+		id, user string
+		offset   int
+		amount   float64
+	}{
+		{"order_ltv_1", "user_ltv_1", -100, 100},
+		{"order_ltv_2", "user_ltv_1", -80, 200},
+		{"order_ltv_3", "user_ltv_1", -20, 300},
+		{"order_ltv_4", "user_ltv_2", -97, 50},
+	} {
+		if _, err := warehouse.ExecContext(ctx, insert, order.id, day(order.offset), order.user, order.amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := reports.GetLTVCurves(ctx, warehouse, metrics.Params{StartDate: day(-100), EndDate: day(-95)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Within 30 and 60 days the customers spent 300 and 50; within 90 the
+	// first spent 300 more. Neither is 120 days old.
+	if got.Customers != 2 || !reflect.DeepEqual(got.Curve, []float64{175, 175, 325}) {
+		t.Errorf("%d customers with curve %v, want 2 with [175 175 325]", got.Customers, got.Curve)
+	}
+	if got.Days30 == nil || *got.Days30 != 175 || got.Days90 == nil || *got.Days90 != 325 || got.Days180 != nil || got.Days365 != nil {
+		t.Errorf("milestones = %v %v %v %v, want 175 325 null null", got.Days30, got.Days90, got.Days180, got.Days365)
+	}
+	if got.ProjectedLTV == nil || *got.ProjectedLTV != 2197.11 {
+		t.Errorf("projected LTV %v, want 2197.11", got.ProjectedLTV)
+	}
+	customers := 0
+	for _, cohort := range got.Cohorts {
+		customers += cohort.Customers
+	}
+	if customers != 2 {
+		t.Errorf("%d customers in cohorts, want 2", customers)
+	}
+
+	// The fixture's customers all first ordered in the last 30 days, too
+	// recently to reach a point of the curve.
+	got, err = reports.GetLTVCurves(ctx, warehouse, metrics.Params{StartDate: day(-29), EndDate: day(0), AccountID: "acct_001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Customers != 20 || len(got.Curve) != 0 || got.Days30 != nil || got.ProjectedLTV != nil {
+		t.Errorf("recent customers: %+v", got)
+	}
+}
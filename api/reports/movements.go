@@ -0,0 +1,132 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+// Movement kinds of the MRR bridge.
+const (
+	MovementNew          = "new"
+	MovementExpansion    = "expansion"
+	MovementReactivation = "reactivation"
+	MovementContraction  = "contraction"
+	MovementChurn        = "churn"
+)
+
+// MRRMovements is the MRR bridge for a window: StartingMRR plus every
+// movement gives EndingMRR, so contraction and churn are negative. Counts
+// holds the number of subscriptions behind each movement.
+type MRRMovements struct {
+	StartingMRR  float64        `json:"starting_mrr"`
+	New          float64        `json:"new"`
+	Expansion    float64        `json:"expansion"`
+	Reactivation float64        `json:"reactivation"`
+	Contraction  float64        `json:"contraction"`
+	Churn        float64        `json:"churn"`
+	EndingMRR    float64        `json:"ending_mrr"`
+	NetChange    float64        `json:"net_change"`
+	Counts       map[string]int `json:"counts"`
+}
+
+// MRRMovementsPoint is the MRR bridge for one period.
+type MRRMovementsPoint struct {
+	Date string `json:"date"`
+	MRRMovements
+}
+
+// maxMovementPeriods bounds the periods of GetMRRMovementsTrend, which runs
+// a query per period.
+const maxMovementPeriods = 120
+
+// GetMRRMovementsTrend is the MRR bridge per period of granularity. Each
+// period opens at the previous one's ending MRR.
+func GetMRRMovementsTrend(ctx context.Context, warehouse db.Warehouse, granularity string, p metrics.Params) ([]MRRMovementsPoint, error) {
+	windows, err := metrics.BucketWindows(p.StartDate, p.EndDate, granularity)
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) > maxMovementPeriods {
+		return nil, fmt.Errorf("%w: more than %d %s periods, use a coarser granularity", metrics.ErrInvalidDateRange, maxMovementPeriods, granularity)
+	}
+	points := make([]MRRMovementsPoint, 0, len(windows))
+	for _, w := range windows {
+		period := p
+		period.StartDate, period.EndDate = w.StartDate, w.EndDate
+		movements, err := GetMRRMovements(ctx, warehouse, period)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, MRRMovementsPoint{Date: w.Date, MRRMovements: movements})
+	}
+	return points, nil
+}
+
+// GetMRRMovements classifies the change in each subscription's MRR between
+// the day before the window and its last day. fact_subscription_mrr holds one
+// row per change, effective until the subscription's next row; a churned
+// subscription gets a row with zero MRR.
+func GetMRRMovements(ctx context.Context, warehouse db.Warehouse, p metrics.Params) (MRRMovements, error) {
+	dialect := warehouse.Dialect()
+	table := dialect.Table("fact_subscription_mrr")
+	b := db.NewBuilder(dialect)
+
+	query := "select h.subscription_id as subscription_id," +
+		" coalesce(sum(case when h.effective_date = l.opening_date then h.mrr end), 0) as opening_mrr," +
+		" coalesce(sum(case when h.effective_date = l.closing_date then h.mrr end), 0) as closing_mrr," +
+		" max(case when h.effective_date < " + b.DateArg(p.StartDate) + " and h.mrr > 0 then 1 else 0 end) as had_mrr" +
+		" from " + table + " h join (" +
+		"select subscription_id," +
+		" max(case when effective_date < " + b.DateArg(p.StartDate) + " then effective_date end) as opening_date," +
+		" max(effective_date) as closing_date" +
+		" from " + table +
+		" where effective_date <= " + b.DateArg(p.EndDate)
+	if p.AccountID != "" {
+		query += " and account_id = " + b.Arg(p.AccountID)
+	}
+	query += " group by subscription_id) l on l.subscription_id = h.subscription_id" +
+		" where h.effective_date <= " + b.DateArg(p.EndDate) +
+		" group by h.subscription_id"
+
+	rows, err := warehouse.Query(ctx, query, b.Args()...)
+	if err != nil {
+		return MRRMovements{}, fmt.Errorf("mrr movements: %w", err)
+	}
+
+	result := MRRMovements{Counts: map[string]int{
+		MovementNew:          0,
+		MovementExpansion:    0,
+		MovementReactivation: 0,
+		MovementContraction:  0,
+		MovementChurn:        0,
+	}}
+	for _, row := range rows {
+		opening := row.Float("opening_mrr")
+		closing := row.Float("closing_mrr")
+		result.StartingMRR += opening
+		result.EndingMRR += closing
+
+		switch {
+		case opening == 0 && closing > 0 && row.Float("had_mrr") > 0:
+			result.Reactivation += closing
+			result.Counts[MovementReactivation]++
+		case opening == 0 && closing > 0:
+			result.New += closing
+			result.Counts[MovementNew]++
+		case opening > 0 && closing == 0:
+			result.Churn -= opening
+			result.Counts[MovementChurn]++
+		case closing > opening:
+			result.Expansion += closing - opening
+			result.Counts[MovementExpansion]++
+		case closing < opening:
+			result.Contraction -= opening - closing
+			result.Counts[MovementContraction]++
+		}
+	}
+	result.NetChange = result.EndingMRR - result.StartingMRR
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package reports_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+// Over the last 30 days the fixture's subscriptions make one of each
+// movement: sub_04 is new (800), sub_05 comes back (900), sub_01 expands
+// from 500 to 700, sub_02 contracts from 600 to 450 and sub_03 churns 700.
+func TestMRRMovements(t *testing.T) {
+	got, err := reports.GetMRRMovements(context.Background(), sqlitetest.Open(t), metrics.Params{StartDate: day(-29), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := reports.MRRMovements{
+		StartingMRR:  1800,
+		New:          800,
+		Expansion:    200,
+		Reactivation: 900,
+		Contraction:  -150,
+		Churn:        -700,
+		EndingMRR:    2850,
+		NetChange:    1050,
+	}
+	counts := got.Counts
+	got.Counts = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("movements = %+v, want %+v", got, want)
+	}
+	for _, kind := range []string{reports.MovementNew, reports.MovementExpansion, reports.MovementReactivation, reports.MovementContraction, reports.MovementChurn} {
+		if counts[kind] != 1 {
+			t.Errorf("%d %s subscriptions, want 1", counts[kind], kind)
+		}
+	}
+}
+
+func TestMRRMovementsTrend(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	p := metrics.Params{StartDate: day(-29), EndDate: day(0)}
+
+	for _, granularity := range []string{"day", "week", "month"} {
+		t.Run(granularity, func(t *testing.T) {
+			points, err := reports.GetMRRMovementsTrend(ctx, warehouse, granularity, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			windows, err := metrics.BucketWindows(p.StartDate, p.EndDate, granularity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != len(windows) {
+				t.Fatalf("%d periods, want %d", len(points), len(windows))
+			}
+			var net float64
+			for i, point := range points {
+				if point.Date != windows[i].Date {
+					t.Errorf("period %d is %s, want %s", i, point.Date, windows[i].Date)
+				}
+				parts := point.StartingMRR + point.New + point.Expansion + point.Reactivation + point.Contraction + point.Churn
+				if parts != point.EndingMRR || point.NetChange != point.EndingMRR-point.StartingMRR {
+					t.Errorf("%s: %v plus movements is %v, ending %v, net change %v", point.Date, point.StartingMRR, parts, point.EndingMRR, point.NetChange)
+				}
+				if i > 0 && point.StartingMRR != points[i-1].EndingMRR {
+					t.Errorf("%s starts at %v, the previous period ended at %v", point.Date, point.StartingMRR, points[i-1].EndingMRR)
+				}
+				net += point.NetChange
+			}
+			if points[0].StartingMRR != 1800 || points[len(points)-1].EndingMRR != 2850 || net != 1050 {
+				t.Errorf("periods go from %v to %v with net change %v, want 1800 to 2850 and 1050", points[0].StartingMRR, points[len(points)-1].EndingMRR, net)
+			}
+		})
+	}
+}
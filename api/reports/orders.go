@@ -0,0 +1,170 @@
+package reports
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+// Order sort keys: the order date or the order's revenue.
+const (
+	OrderSortDate   = "order_date"
+	OrderSortAmount = "amount"
+)
+
+var (
+	ErrUnknownOrderSort = errors.New("sort must be order_date or amount")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+)
+
+// decimalText matches the amounts cursors carry, as printed by
+// Dialect.DecimalText.
+var decimalText = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// orderColumns are the fact_orders columns returned for each order.
+var orderColumns = []string{"order_id", "order_date", "account_id", "user_id", "product_id", "net_amount", "currency"}
+
+// Order is one fact_orders row. NetAmount is in the order's own currency;
+// Amount is what the order contributes to revenue, in the reporting
+// currency.
+type Order struct {
+	OrderID   string  `json:"order_id"`
+	OrderDate string  `json:"order_date"`
+	AccountID string  `json:"account_id"`
+	UserID    string  `json:"user_id,omitempty"`
+	ProductID string  `json:"product_id,omitempty"`
+	Currency  string  `json:"currency,omitempty"`
+	NetAmount float64 `json:"net_amount"`
+	Amount    float64 `json:"amount"`
+}
+
+// OrderPage is one page of the orders behind the revenue metric. Revenue is
+// the metric for the same window and filters: the amounts of every page add
+// up to it. NextCursor is null on the last page.
+type OrderPage struct {
+	Sort       string  `json:"sort"`
+	Order      string  `json:"order"`
+	Revenue    float64 `json:"revenue"`
+	Orders     []Order `json:"orders"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// orderCursor is the position after the last order of a page. Value is the
+// order date, or the amount as the exact text the warehouse sorted on: a
+// float64 could fall between two amounts and skip or repeat orders.
+type orderCursor struct {
+	Sort    string `json:"s"`
+	Order   string `json:"o"`
+	Value   string `json:"v"`
+	OrderID string `json:"k"`
+}
+
+// GetOrders pages through the orders the revenue metric sums, under the same
+// filters and currency conversion.
+func GetOrders(ctx context.Context, registry *metrics.Registry, warehouse db.Warehouse, sortBy, order, cursor string, limit int, p metrics.Params) (OrderPage, error) {
+	drill := metrics.Drill{Columns: orderColumns, Key: "order_id", Limit: limit + 1}
+	switch sortBy {
+	case OrderSortDate:
+		drill.Sort = "order_date"
+	case OrderSortAmount:
+		drill.Sort = metrics.DrillValue
+	default:
+		return OrderPage{}, fmt.Errorf("%w: %s", ErrUnknownOrderSort, sortBy)
+	}
+	if order != SortAscending && order != SortDescending {
+		return OrderPage{}, fmt.Errorf("%w: %s", ErrUnknownOrder, order)
+	}
+	drill.Descending = order == SortDescending
+	if cursor != "" {
+		after, err := decodeOrderCursor(cursor, sortBy, order)
+		if err != nil {
+			return OrderPage{}, err
+		}
+		drill.After = []interface{}{after.Value, after.OrderID}
+	}
+
+	rows, err := registry.Drill(ctx, warehouse, "revenue", drill, p)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	revenue, err := registry.Evaluate(ctx, warehouse, "revenue", p)
+	if err != nil {
+		return OrderPage{}, err
+	}
+
+	result := OrderPage{Sort: sortBy, Order: order, Revenue: revenue.Value, Orders: make([]Order, 0, len(rows))}
+	for i, row := range rows {
+		if i == limit {
+			last := result.Orders[limit-1]
+			next := orderCursor{Sort: sortBy, Order: order, Value: last.OrderDate, OrderID: last.OrderID}
+			if sortBy == OrderSortAmount {
+				next.Value = rows[limit-1].String(metrics.DrillSortKey)
+			}
+			encoded := encodeOrderCursor(next)
+			result.NextCursor = &encoded
+			break
+		}
+		result.Orders = append(result.Orders, Order{
+			OrderID:   row.String("order_id"),
+			OrderDate: row.Date("order_date"),
+			AccountID: row.String("account_id"),
+			UserID:    row.String("user_id"),
+			ProductID: row.String("product_id"),
+			Currency:  row.String("currency"),
+			NetAmount: row.Float("net_amount"),
+			Amount:    row.Float(metrics.DrillValue),
+		})
+	}
+	return result, nil
+}
+
+func encodeOrderCursor(c orderCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeOrderCursor reads a cursor, rejecting one issued for another sort.
+func decodeOrderCursor(cursor, sortBy, order string) (orderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return orderCursor{}, ErrInvalidCursor
+	}
+	var c orderCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.OrderID == "" {
+		return orderCursor{}, ErrInvalidCursor
+	}
+	if c.Sort != sortBy || c.Order != order {
+		return orderCursor{}, fmt.Errorf("%w: it was issued for sort %s, order %s", ErrInvalidCursor, c.Sort, c.Order)
+	}
+	switch sortBy {
+	case OrderSortDate:
+		if _, err := time.Parse("2006-01-02", c.Value); err != nil {
+			return orderCursor{}, ErrInvalidCursor
+		}
+	case OrderSortAmount:
+		if !decimalText.MatchString(c.Value) {
+			return orderCursor{}, ErrInvalidCursor
+		}
+	}
+	return c, nil
+}
+
+// orderAmount is the net amount of the fact_orders rows aliased alias in
+// USD, converted at order-date rates as the revenue metric converts it,
+// with the join the conversion needs.
+func orderAmount(dialect db.Dialect, alias string) (string, string) {
+	return metrics.ToDefaultCurrency(dialect, "fx", alias+".net_amount", alias+".currency", alias+".order_date")
+}
+
+// checkOrderRates rejects windows, from start to end or open-ended when end
+// is empty, holding orders orderAmount has no rate for.
+func checkOrderRates(ctx context.Context, warehouse db.Warehouse, start, end string) error {
+	return metrics.CheckRates(ctx, warehouse, "fact_orders", "currency", "order_date", start, end)
+}
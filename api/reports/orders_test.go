@@ -0,0 +1,114 @@
+package reports_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+func TestOrdersPageThroughRevenue(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+
+	// Orders in other currencies convert to amounts with long fractions, and
+	// pairs of them tie on amount and date.
+	now := time.Now().UTC()
+	insert := `insert into fact_orders (order_id, order_date, account_id, user_id, product_id, net_amount, currency) values (?, ?, 'acct_001', 'user_001', 'prod_001', ?, ?)`
+	for i := 0; i < 12; i++ {
+		date := now.AddDate(0, 0, -(i / 2)).Format("2006-01-02")
+		currency := []string{"EUR", "GBP", "CAD"}[i%3]
+		amount := 100.1 + float64(i/2)/3
+		if _, err := warehouse.ExecContext(ctx, insert, fmt.Sprintf("order_fx_%02d", i), date, amount, currency); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := metrics.Params{StartDate: now.AddDate(0, 0, -29).Format("2006-01-02"), EndDate: now.Format("2006-01-02")}
+
+	tests := []struct {
+		sort  string
+		order string
+	}{
+		{sort: reports.OrderSortAmount, order: reports.SortAscending},
+		{sort: reports.OrderSortAmount, order: reports.SortDescending},
+		{sort: reports.OrderSortDate, order: reports.SortAscending},
+		{sort: reports.OrderSortDate, order: reports.SortDescending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort+" "+tt.order, func(t *testing.T) {
+			seen := map[string]bool{}
+			var sum, revenue float64
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > 50 {
+					t.Fatal("paging does not end")
+				}
+				page, err := reports.GetOrders(ctx, registry, warehouse, tt.sort, tt.order, cursor, 4, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				revenue = page.Revenue
+				for _, order := range page.Orders {
+					if seen[order.OrderID] {
+						t.Errorf("%s listed twice", order.OrderID)
+					}
+					seen[order.OrderID] = true
+					sum += order.Amount
+				}
+				if page.NextCursor == nil {
+					break
+				}
+				cursor = *page.NextCursor
+			}
+			if len(seen) != 42 {
+				t.Errorf("%d orders, want 42", len(seen))
+			}
+			if math.Abs(sum-revenue) > 0.005 {
+				t.Errorf("orders add up to %.4f, revenue is %.4f", sum, revenue)
+			}
+		})
+	}
+}
+
+func TestOrdersCursor(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	registry := metrics.NewRegistry()
+	now := time.Now().UTC()
+	p := metrics.Params{StartDate: now.AddDate(0, 0, -29).Format("2006-01-02"), EndDate: now.Format("2006-01-02")}
+
+	page, err := reports.GetOrders(ctx, registry, warehouse, reports.OrderSortAmount, reports.SortDescending, "", 5, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.NextCursor == nil {
+		t.Fatal("no next cursor")
+	}
+
+	tests := []struct {
+		name   string
+		sort   string
+		order  string
+		cursor string
+	}{
+		{name: "other sort", sort: reports.OrderSortDate, order: reports.SortDescending, cursor: *page.NextCursor},
+		{name: "other order", sort: reports.OrderSortAmount, order: reports.SortAscending, cursor: *page.NextCursor},
+		{name: "not base64", sort: reports.OrderSortAmount, order: reports.SortDescending, cursor: "%%%"},
+		// {"s":"amount","o":"desc","v":"1; drop","k":"order_01"}
+		{name: "amount is not a number", sort: reports.OrderSortAmount, order: reports.SortDescending, cursor: "eyJzIjoiYW1vdW50IiwibyI6ImRlc2MiLCJ2IjoiMTsgZHJvcCIsImsiOiJvcmRlcl8wMSJ9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := reports.GetOrders(ctx, registry, warehouse, tt.sort, tt.order, tt.cursor, 5, p); !errors.Is(err, reports.ErrInvalidCursor) {
+				t.Errorf("err = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
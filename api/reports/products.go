@@ -0,0 +1,217 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+// Product rankings.
+const (
+	ProductSortRevenue = "revenue"
+	ProductSortOrders  = "orders"
+)
+
+var ErrUnknownProductSort = errors.New("sort must be revenue or orders")
+
+// ProductSales is one product's orders in the window. fact_orders has one
+// product per order but no quantity, so prices are per order:
+// AvgRealizedPrice is net revenue per order and PriceRealization is that as
+// a percentage of the list BasePrice, null when the product has no base
+// price. An order of several units realizes more than its list price.
+type ProductSales struct {
+	ProductID        string   `json:"product_id"`
+	SKU              string   `json:"sku,omitempty"`
+	Name             string   `json:"name,omitempty"`
+	Category         string   `json:"category"`
+	Type             string   `json:"type,omitempty"`
+	Revenue          float64  `json:"revenue"`
+	Orders           int      `json:"orders"`
+	RevenueShare     float64  `json:"revenue_share"`
+	AvgRealizedPrice float64  `json:"avg_realized_price"`
+	BasePrice        *float64 `json:"base_price"`
+	PriceRealization *float64 `json:"price_realization"`
+}
+
+// TopProducts ranks the products sold in the window. Revenue and Orders are
+// totals over every product, not just the ones listed.
+type TopProducts struct {
+	Sort     string         `json:"sort"`
+	Revenue  float64        `json:"revenue"`
+	Orders   int            `json:"orders"`
+	Products []ProductSales `json:"products"`
+}
+
+// CategoryShare is one product category's part of a bucket.
+type CategoryShare struct {
+	Category string  `json:"category"`
+	Revenue  float64 `json:"revenue"`
+	Orders   int     `json:"orders"`
+	Share    float64 `json:"share"`
+}
+
+// CategoryMixPoint is the revenue of one bucket split by product category,
+// with every category listed in every bucket.
+type CategoryMixPoint struct {
+	Date       string          `json:"date"`
+	Revenue    float64         `json:"revenue"`
+	Categories []CategoryShare `json:"categories"`
+}
+
+// GetTopProducts returns the limit products with the most revenue or orders
+// in the window. Orders without a product, or whose product is missing from
+// dim_product, are reported under the "unknown" category.
+func GetTopProducts(ctx context.Context, warehouse db.Warehouse, sortBy string, limit int, p metrics.Params) (TopProducts, error) {
+	if sortBy != ProductSortRevenue && sortBy != ProductSortOrders {
+		return TopProducts{}, fmt.Errorf("%w: %s", ErrUnknownProductSort, sortBy)
+	}
+	if err := checkOrderRates(ctx, warehouse, p.StartDate, p.EndDate); err != nil {
+		return TopProducts{}, err
+	}
+	dialect := warehouse.Dialect()
+	b := db.NewBuilder(dialect)
+	amount, rates := orderAmount(dialect, "f")
+	query := "select f.product_id as product_id, d.sku as sku, d.product_name as product_name," +
+		" d.product_category as product_category, d.product_type as product_type, d.base_price as base_price," +
+		" count(*) as orders, sum(" + amount + ") as revenue" +
+		" from " + dialect.Table("fact_orders") + " f left join " + dialect.Table("dim_product") + " d on d.product_id = f.product_id" + rates +
+		" where f.order_date between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate) + productAccount(b, p) +
+		" group by f.product_id, d.sku, d.product_name, d.product_category, d.product_type, d.base_price"
+	rows, err := warehouse.Query(ctx, query, b.Args()...)
+	if err != nil {
+		return TopProducts{}, fmt.Errorf("top products: %w", err)
+	}
+
+	result := TopProducts{Sort: sortBy, Products: make([]ProductSales, 0, len(rows))}
+	for _, row := range rows {
+		product := ProductSales{
+			ProductID: row.String("product_id"),
+			SKU:       row.String("sku"),
+			Name:      row.String("product_name"),
+			Category:  category(row),
+			Type:      row.String("product_type"),
+			Revenue:   row.Float("revenue"),
+			Orders:    row.Int("orders"),
+		}
+		if product.Orders > 0 {
+			product.AvgRealizedPrice = roundTo(product.Revenue/float64(product.Orders), 2)
+		}
+		if row["base_price"] != nil {
+			base := row.Float("base_price")
+			product.BasePrice = &base
+			if base != 0 {
+				realization := roundTo(product.AvgRealizedPrice/base*100, 2)
+				product.PriceRealization = &realization
+			}
+		}
+		result.Revenue += product.Revenue
+		result.Orders += product.Orders
+		result.Products = append(result.Products, product)
+	}
+
+	sort.Slice(result.Products, func(i, j int) bool {
+		a, b := result.Products[i], result.Products[j]
+		if sortBy == ProductSortOrders && a.Orders != b.Orders {
+			return a.Orders > b.Orders
+		}
+		if a.Revenue != b.Revenue {
+			return a.Revenue > b.Revenue
+		}
+		return a.ProductID < b.ProductID
+	})
+	if len(result.Products) > limit {
+		result.Products = result.Products[:limit]
+	}
+	for i := range result.Products {
+		if result.Revenue != 0 {
+			result.Products[i].RevenueShare = roundTo(result.Products[i].Revenue/result.Revenue*100, 2)
+		}
+		result.Products[i].Revenue = roundTo(result.Products[i].Revenue, 2)
+	}
+	result.Revenue = roundTo(result.Revenue, 2)
+	return result, nil
+}
+
+// GetCategoryMix splits revenue by product category per bucket of
+// granularity. Shares are percentages of the bucket's revenue.
+func GetCategoryMix(ctx context.Context, warehouse db.Warehouse, granularity string, p metrics.Params) ([]CategoryMixPoint, error) {
+	dates, err := metrics.BucketDates(p.StartDate, p.EndDate, granularity)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOrderRates(ctx, warehouse, p.StartDate, p.EndDate); err != nil {
+		return nil, err
+	}
+	dialect := warehouse.Dialect()
+	bucket := dialect.DateTrunc("f.order_date", granularity)
+	b := db.NewBuilder(dialect)
+	amount, rates := orderAmount(dialect, "f")
+	query := "select " + bucket + " as bucket, d.product_category as product_category, count(*) as orders, sum(" + amount + ") as revenue" +
+		" from " + dialect.Table("fact_orders") + " f left join " + dialect.Table("dim_product") + " d on d.product_id = f.product_id" + rates +
+		" where f.order_date between " + b.DateArg(p.StartDate) + " and " + b.DateArg(p.EndDate) + productAccount(b, p) +
+		" group by " + bucket + ", d.product_category"
+	rows, err := warehouse.Query(ctx, query, b.Args()...)
+	if err != nil {
+		return nil, fmt.Errorf("category mix: %w", err)
+	}
+
+	type sales struct {
+		revenue float64
+		orders  int
+	}
+	byBucket := map[string]map[string]sales{}
+	seen := map[string]bool{}
+	var categories []string
+	for _, row := range rows {
+		date, name := row.Date("bucket"), category(row)
+		if byBucket[date] == nil {
+			byBucket[date] = map[string]sales{}
+		}
+		s := byBucket[date][name]
+		s.revenue += row.Float("revenue")
+		s.orders += row.Int("orders")
+		byBucket[date][name] = s
+		if !seen[name] {
+			seen[name] = true
+			categories = append(categories, name)
+		}
+	}
+	sort.Strings(categories)
+
+	points := make([]CategoryMixPoint, 0, len(dates))
+	for _, date := range dates {
+		point := CategoryMixPoint{Date: date, Categories: make([]CategoryShare, 0, len(categories))}
+		for _, name := range categories {
+			point.Revenue += byBucket[date][name].revenue
+		}
+		for _, name := range categories {
+			s := byBucket[date][name]
+			share := CategoryShare{Category: name, Revenue: roundTo(s.revenue, 2), Orders: s.orders}
+			if point.Revenue != 0 {
+				share.Share = roundTo(s.revenue/point.Revenue*100, 2)
+			}
+			point.Categories = append(point.Categories, share)
+		}
+		point.Revenue = roundTo(point.Revenue, 2)
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+func productAccount(b *db.Builder, p metrics.Params) string {
+	if p.AccountID == "" {
+		return ""
+	}
+	return " and f.account_id = " + b.Arg(p.AccountID)
+}
+
+func category(row db.Row) string {
+	if name := row.String("product_category"); name != "" {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,109 @@
+package reports_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+// The last ten days' orders are for prod_001 (platform) on days 0, -3, -6
+// and -9, prod_002 (add_on) on -1, -4 and -7 and prod_003 (services) on -2,
+// -5 and -8.
+func TestTopProducts(t *testing.T) {
+	ctx := context.Background()
+	warehouse := sqlitetest.Open(t)
+	p := metrics.Params{StartDate: day(-9), EndDate: day(0)}
+
+	tests := []struct {
+		name    string
+		sort    string
+		limit   int
+		want    []string
+		revenue []float64
+		share   []float64
+	}{
+		{name: "by revenue", sort: reports.ProductSortRevenue, limit: 10, want: []string{"prod_001", "prod_003", "prod_002"}, revenue: []float64{4450, 3375, 3300}, share: []float64{40, 30.34, 29.66}},
+		{name: "top two", sort: reports.ProductSortRevenue, limit: 2, want: []string{"prod_001", "prod_003"}, revenue: []float64{4450, 3375}, share: []float64{40, 30.34}},
+		{name: "by orders", sort: reports.ProductSortOrders, limit: 10, want: []string{"prod_001", "prod_003", "prod_002"}, revenue: []float64{4450, 3375, 3300}, share: []float64{40, 30.34, 29.66}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reports.GetTopProducts(ctx, warehouse, tt.sort, tt.limit, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Revenue != 11125 || got.Orders != 10 {
+				t.Errorf("totals %v and %d orders, want 11125 and 10", got.Revenue, got.Orders)
+			}
+			if len(got.Products) != len(tt.want) {
+				t.Fatalf("%d products, want %d", len(got.Products), len(tt.want))
+			}
+			for i, product := range got.Products {
+				if product.ProductID != tt.want[i] || product.Revenue != tt.revenue[i] || product.RevenueShare != tt.share[i] {
+					t.Errorf("product %d = %s %v (%v%%), want %s %v (%v%%)", i, product.ProductID, product.Revenue, product.RevenueShare, tt.want[i], tt.revenue[i], tt.share[i])
+				}
+			}
+		})
+	}
+
+	// Prices are per order: prod_001 lists at 1000, prod_002 at 50 and
+	// prod_003 at 1500.
+	got, err := reports.GetTopProducts(ctx, warehouse, reports.ProductSortOrders, 10, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices := []struct {
+		orders      int
+		price       float64
+		realization float64
+	}{
+		{orders: 4, price: 1112.5, realization: 111.25},
+		{orders: 3, price: 1125, realization: 75},
+		{orders: 3, price: 1100, realization: 2200},
+	}
+	for i, product := range got.Products {
+		want := prices[i]
+		if product.Orders != want.orders || product.AvgRealizedPrice != want.price || product.PriceRealization == nil || *product.PriceRealization != want.realization {
+			t.Errorf("%s: %d orders at %v (%v%%), want %d at %v (%v%%)", product.ProductID, product.Orders, product.AvgRealizedPrice, product.PriceRealization, want.orders, want.price, want.realization)
+		}
+	}
+
+	if _, err := reports.GetTopProducts(ctx, warehouse, "margin", 10, p); !errors.Is(err, reports.ErrUnknownProductSort) {
+		t.Errorf("err = %v, want ErrUnknownProductSort", err)
+	}
+}
+
+func TestCategoryMix(t *testing.T) {
+	points, err := reports.GetCategoryMix(context.Background(), sqlitetest.Open(t), "day", metrics.Params{StartDate: day(-3), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Day -i sells 1000 + 25i of platform, add_on, services in turn.
+	categories := []string{"platform", "add_on", "services"}
+	if len(points) != 4 {
+		t.Fatalf("%d points, want 4", len(points))
+	}
+	for i, point := range points {
+		offset := 3 - i
+		sold := categories[offset%3]
+		if point.Date != day(-offset) || point.Revenue != float64(1000+offset*25) {
+			t.Errorf("point %d = %s %v, want %s %v", i, point.Date, point.Revenue, day(-offset), 1000+offset*25)
+		}
+		if len(point.Categories) != 3 {
+			t.Fatalf("%s: categories %+v, want all three", point.Date, point.Categories)
+		}
+		for _, share := range point.Categories {
+			want := 0.0
+			if share.Category == sold {
+				want = 100
+			}
+			if share.Share != want {
+				t.Errorf("%s: %s share %v, want %v", point.Date, share.Category, share.Share, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package reports
+
+import (
+	"context"
+
+	"revenue-dashboard-api/db"
+	"revenue-dashboard-api/metrics"
+)
+
+// RevenueBreakdown decomposes revenue the way fact_orders does: gross less
+// discounts, refunds and tax is net. The rates are percentages of gross.
+type RevenueBreakdown struct {
+	Gross        float64 `json:"gross"`
+	Discounts    float64 `json:"discounts"`
+	Refunds      float64 `json:"refunds"`
+	Tax          float64 `json:"tax"`
+	Net          float64 `json:"net"`
+	RefundRate   float64 `json:"refund_rate"`
+	DiscountRate float64 `json:"discount_rate"`
+}
+
+// RevenueBreakdownPoint is the breakdown for one trend bucket.
+type RevenueBreakdownPoint struct {
+	Date string `json:"date"`
+	RevenueBreakdown
+}
+
+// revenueParts are the registry metrics behind the amounts of the
+// breakdown.
+var revenueParts = []string{"gross_revenue", "discounts", "refunds", "tax", "revenue"}
+
+// GetRevenueBreakdown evaluates the parts of revenue through the semantic
+// layer, so filters and the reporting currency apply as they do to revenue.
+func GetRevenueBreakdown(ctx context.Context, registry *metrics.Registry, warehouse db.Warehouse, p metrics.Params) (RevenueBreakdown, error) {
+	values := map[string]float64{}
+	for _, name := range revenueParts {
+		value, err := registry.Evaluate(ctx, warehouse, name, p)
+		if err != nil {
+			return RevenueBreakdown{}, err
+		}
+		values[name] = value.Value
+	}
+	return revenueBreakdown(values), nil
+}
+
+// GetRevenueBreakdownTrend is the breakdown per bucket of granularity.
+func GetRevenueBreakdownTrend(ctx context.Context, registry *metrics.Registry, warehouse db.Warehouse, granularity string, p metrics.Params) ([]RevenueBreakdownPoint, error) {
+	var dates []string
+	values := map[string]map[string]float64{}
+	for _, name := range revenueParts {
+		series, err := registry.Trend(ctx, warehouse, name, granularity, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range series {
+			if values[point.Date] == nil {
+				dates = append(dates, point.Date)
+				values[point.Date] = map[string]float64{}
+			}
+			values[point.Date][name] = point.Value
+		}
+	}
+
+	points := make([]RevenueBreakdownPoint, 0, len(dates))
+	for _, date := range dates {
+		points = append(points, RevenueBreakdownPoint{Date: date, RevenueBreakdown: revenueBreakdown(values[date])})
+	}
+	return points, nil
+}
+
+func revenueBreakdown(values map[string]float64) RevenueBreakdown {
+	b := RevenueBreakdown{
+		Gross:     values["gross_revenue"],
+		Discounts: values["discounts"],
+		Refunds:   values["refunds"],
+		Tax:       values["tax"],
+		Net:       values["revenue"],
+	}
+	if b.Gross != 0 {
+		b.RefundRate = roundTo(b.Refunds/b.Gross*100, 4)
+		b.DiscountRate = roundTo(b.Discounts/b.Gross*100, 4)
+	}
+	return b
+}
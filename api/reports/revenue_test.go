@@ -0,0 +1,54 @@
+package reports_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"revenue-dashboard-api/db/sqlite/sqlitetest"
+	"revenue-dashboard-api/metrics"
+	"revenue-dashboard-api/reports"
+)
+
+func TestRevenueBreakdown(t *testing.T) {
+	got, err := reports.GetRevenueBreakdown(context.Background(), metrics.NewRegistry(), sqlitetest.Open(t), metrics.Params{StartDate: day(-9), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := reports.RevenueBreakdown{Gross: 12315, Discounts: 200, Refunds: 100, Tax: 890, Net: 11125, RefundRate: 0.812, DiscountRate: 1.624}
+	if got != want {
+		t.Errorf("breakdown = %+v, want %+v", got, want)
+	}
+}
+
+// Each day's gross revenue less its discounts, refunds and tax is its net
+// revenue; the fixture discounts every third day and refunds on day -4.
+func TestRevenueBreakdownTrend(t *testing.T) {
+	points, err := reports.GetRevenueBreakdownTrend(context.Background(), metrics.NewRegistry(), sqlitetest.Open(t), "day", metrics.Params{StartDate: day(-5), EndDate: day(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 6 {
+		t.Fatalf("%d points, want 6", len(points))
+	}
+	for i, point := range points {
+		offset := 5 - i
+		if point.Date != day(-offset) {
+			t.Errorf("point %d is %s, want %s", i, point.Date, day(-offset))
+		}
+		net := float64(1000 + offset*25)
+		var discount, refund float64
+		if offset%3 == 0 {
+			discount = 50
+		}
+		if offset == 4 {
+			refund = 100
+		}
+		if point.Net != net || point.Discounts != discount || point.Refunds != refund {
+			t.Errorf("%s: net %v, discounts %v, refunds %v, want %v, %v, %v", point.Date, point.Net, point.Discounts, point.Refunds, net, discount, refund)
+		}
+		if math.Abs(point.Gross-point.Discounts-point.Refunds-point.Tax-point.Net) > 1e-6 {
+			t.Errorf("%s: gross %v does not break down into %+v", point.Date, point.Gross, point.RevenueBreakdown)
+		}
+	}
+}
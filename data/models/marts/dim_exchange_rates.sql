@@ -0,0 +1,7 @@
+select
+    cast(rate_date as date) as rate_date,
+    upper(from_currency) as from_currency,
+    upper(to_currency) as to_currency,
+    cast(rate as numeric) as rate
+from {{ source('app', 'exchange_rates') }}
+where rate is not null
@@ -2,14 +2,16 @@ interface KPICardProps {
   title: string;
   value: string;
   subtitle?: string;
+  change?: string;
 }
 
-export function KPICard({ title, value, subtitle }: KPICardProps) {
+export function KPICard({ title, value, subtitle, change }: KPICardProps) {
   return (
     <div className="kpi-card">
       <div className="kpi-title">{title}</div>
       <div className="kpi-value">{value}</div>
       {subtitle && <div className="kpi-subtitle">{subtitle}</div>}
+      {change && <div className="kpi-change">{change}</div>}
     </div>
   );
 }
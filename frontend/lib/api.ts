@@ -1,16 +1,47 @@
-export interface MetricResponse {
-  metric: string;
-  value: string;
-  updated_at: string;
-  cached: boolean;
-  time_window: string;
+import type { Metric, MetricError } from './types';
+
+export type MetricResponse = Metric;
+
+// MetricRequestError carries the HTTP status of a failed metric request, so
+// callers can tell a refused metric (403) from a failing one.
+export class MetricRequestError extends Error {
+  constructor(message: string, public readonly status: number) {
+    super(message);
+  }
 }
 
-export async function fetchMetric(metric: string): Promise<MetricResponse> {
+export function isForbidden(error: unknown): boolean {
+  return error instanceof MetricRequestError && error.status === 403;
+}
+
+export async function fetchMetric(metric: string, params: Record<string, string> = {}): Promise<MetricResponse> {
   const baseUrl = process.env.NEXT_PUBLIC_API_BASE_URL || 'http://localhost:8080';
-  const response = await fetch(`${baseUrl}/api/metrics/${metric}`);
+  const query = new URLSearchParams(params).toString();
+  const response = await fetch(`${baseUrl}/api/metrics/${metric}${query ? `?${query}` : ''}`);
   if (!response.ok) {
-    throw new Error('Failed to fetch metric');
+    const body: MetricError | null = await response.json().catch(() => null);
+    throw new MetricRequestError(body?.message ?? 'Failed to fetch metric', response.status);
   }
   return response.json();
 }
+
+export function formatMetric(metric: MetricResponse): string {
+  if (typeof metric.value !== 'number') {
+    return '-';
+  }
+  if (metric.unit === 'percent') {
+    return `${metric.value.toFixed(2)}%`;
+  }
+  if (metric.unit === 'currency') {
+    return metric.value.toFixed(2);
+  }
+  return String(metric.value);
+}
+
+export function formatChange(metric: MetricResponse): string | undefined {
+  const percent = metric.comparison?.change_percent;
+  if (percent === undefined) {
+    return undefined;
+  }
+  return `${percent > 0 ? '+' : ''}${percent.toFixed(1)}% vs previous period`;
+}
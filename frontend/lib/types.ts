@@ -1,7 +1,38 @@
+export type MetricUnit = 'currency' | 'percent' | 'count';
+
+export interface TrendPoint {
+  date: string;
+  value: number;
+}
+
+export interface BreakdownRow {
+  dimension_value: string;
+  value: number;
+}
+
+export interface Comparison {
+  value: number;
+  time_window: string;
+  change: number;
+  change_percent?: number;
+}
+
 export interface Metric {
   metric: string;
-  value: string;
+  value: number | TrendPoint[] | BreakdownRow[];
+  unit?: MetricUnit;
+  currency?: string;
+  numerator?: number;
+  denominator?: number;
   updated_at: string;
   cached: boolean;
   time_window: string;
+  granularity?: 'day' | 'week' | 'month' | 'quarter' | 'year';
+  comparison?: Comparison;
+}
+
+export interface MetricError {
+  error: string;
+  metric?: string;
+  message?: string;
 }
@@ -2,9 +2,10 @@ import { useEffect, useState } from 'react';
 import { DashboardLayout } from '../components/DashboardLayout';
 import { KPICard } from '../components/KPICard';
 import { LineChart } from '../components/LineChart';
-import { fetchMetric } from '../lib/api';
+import { fetchMetric, formatChange, formatMetric, isForbidden } from '../lib/api';
+import type { TrendPoint } from '../lib/types';
 
-type TrendPoint = { date: string; value: number };
+const NOT_PERMITTED = 'Not permitted';
 
 export default function Home() {
   const [revenue, setRevenue] = useState<string>('0');
@@ -17,44 +18,45 @@ export default function Home() {
   const [cac, setCac] = useState<string>('0');
   const [revenueTrend, setRevenueTrend] = useState<TrendPoint[]>([]);
   const [conversionTrend, setConversionTrend] = useState<TrendPoint[]>([]);
+  const [changes, setChanges] = useState<Record<string, string | undefined>>({});
 
   useEffect(() => {
-    const load = async () => {
-      const revenueMetric = await fetchMetric('revenue');
-      const conversionMetric = await fetchMetric('conversion-rate');
-      const arpuMetric = await fetchMetric('arpu');
-      const mrrMetric = await fetchMetric('mrr');
-      const nrrMetric = await fetchMetric('nrr');
-      const churnMetric = await fetchMetric('churn-rate');
-      const ltvMetric = await fetchMetric('ltv');
-      const cacMetric = await fetchMetric('cac');
-      const revenueTrendMetric = await fetchMetric('revenue-trend');
-      const conversionTrendMetric = await fetchMetric('conversion-trend');
+    const compare = { compare: 'previous_period' };
 
-      setRevenue(revenueMetric.value ?? '0');
-      setConversion(conversionMetric.value ?? '0%');
-      setArpu(arpuMetric.value ?? '0');
-      setMrr(mrrMetric.value ?? '0');
-      setNrr(nrrMetric.value ?? '0%');
-      setChurn(churnMetric.value ?? '0%');
-      setLtv(ltvMetric.value ?? '0');
-      setCac(cacMetric.value ?? '0');
-      setRevenueTrend(Array.isArray(revenueTrendMetric.value) ? revenueTrendMetric.value : []);
-      setConversionTrend(Array.isArray(conversionTrendMetric.value) ? conversionTrendMetric.value : []);
+    // Each card loads on its own, so a metric the caller's roles don't grant
+    // (403) or a failing one only affects its own card.
+    const loadCard = (
+      metric: string,
+      params: Record<string, string>,
+      setValue: (value: string) => void,
+      fallback: string,
+      changeKey?: string,
+    ) => {
+      fetchMetric(metric, params)
+        .then((response) => {
+          setValue(formatMetric(response));
+          if (changeKey) {
+            setChanges((previous) => ({ ...previous, [changeKey]: formatChange(response) }));
+          }
+        })
+        .catch((error) => setValue(isForbidden(error) ? NOT_PERMITTED : fallback));
+    };
+    const loadTrend = (metric: string, setTrend: (points: TrendPoint[]) => void) => {
+      fetchMetric(metric)
+        .then((response) => setTrend(Array.isArray(response.value) ? (response.value as TrendPoint[]) : []))
+        .catch(() => setTrend([]));
     };
 
-    load().catch(() => {
-      setRevenue('0');
-      setConversion('0%');
-      setArpu('0');
-      setMrr('0');
-      setNrr('0%');
-      setChurn('0%');
-      setLtv('0');
-      setCac('0');
-      setRevenueTrend([]);
-      setConversionTrend([]);
-    });
+    loadCard('revenue', compare, setRevenue, '0', 'revenue');
+    loadCard('conversion-rate', compare, setConversion, '0%', 'conversion');
+    loadCard('arpu', compare, setArpu, '0', 'arpu');
+    loadCard('mrr', {}, setMrr, '0');
+    loadCard('nrr', compare, setNrr, '0%', 'nrr');
+    loadCard('churn-rate', compare, setChurn, '0%', 'churn');
+    loadCard('ltv', compare, setLtv, '0', 'ltv');
+    loadCard('cac', compare, setCac, '0', 'cac');
+    loadTrend('revenue-trend', setRevenueTrend);
+    loadTrend('conversion-trend', setConversionTrend);
   }, []);
 
   const revenueRows = revenueTrend.slice(-14);
@@ -67,14 +69,14 @@ export default function Home() {
         <div className="section-subtitle">Core KPIs for the last 30 days</div>
       </div>
       <div className="grid">
-        <KPICard title="Revenue" value={revenue} subtitle="Last 30 days" />
-        <KPICard title="Conversion Rate" value={conversion} subtitle="Last 30 days" />
-        <KPICard title="ARPU" value={arpu} subtitle="Last 30 days" />
+        <KPICard title="Revenue" value={revenue} subtitle="Last 30 days" change={changes.revenue} />
+        <KPICard title="Conversion Rate" value={conversion} subtitle="Last 30 days" change={changes.conversion} />
+        <KPICard title="ARPU" value={arpu} subtitle="Last 30 days" change={changes.arpu} />
         <KPICard title="MRR" value={mrr} subtitle="Current" />
-        <KPICard title="NRR" value={nrr} subtitle="Last 30 days" />
-        <KPICard title="Churn Rate" value={churn} subtitle="Last 30 days" />
-        <KPICard title="LTV" value={ltv} subtitle="Derived" />
-        <KPICard title="CAC" value={cac} subtitle="Last 30 days" />
+        <KPICard title="NRR" value={nrr} subtitle="Last 30 days" change={changes.nrr} />
+        <KPICard title="Churn Rate" value={churn} subtitle="Last 30 days" change={changes.churn} />
+        <KPICard title="LTV" value={ltv} subtitle="Derived" change={changes.ltv} />
+        <KPICard title="CAC" value={cac} subtitle="Last 30 days" change={changes.cac} />
       </div>
 
       <div className="section-header">